@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// basePathPattern matches base paths made of unreserved URL characters, which
+// look the same escaped and unescaped
+var basePathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// basePath is server.base_path the server was started with, e.g.
+// "/tools/es-board", or empty when the board is served at the root. Changes
+// require a restart.
+var basePath string
+
+// validateBasePath normalizes server.base_path to a path with a leading and
+// without a trailing slash, "/" becomes empty
+func validateBasePath(cfg *ServerConfig) error {
+	p := strings.TrimRight(cfg.BasePath, "/")
+	if p == "" {
+		cfg.BasePath = ""
+		return nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if !basePathPattern.MatchString(p) {
+		return fmt.Errorf("server.base_path: %q is not a plain URL path like /tools/es-board", cfg.BasePath)
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("server.base_path: %q must not contain . or .. segments", cfg.BasePath)
+		}
+	}
+	cfg.BasePath = p
+	return nil
+}
+
+// withBasePath prefixes an absolute path of the board with the base path, for
+// links, redirects and cookies
+func withBasePath(path string) string {
+	return basePath + path
+}
+
+// basePathMiddleware serves the board below prefix: the prefix is stripped
+// before the request reaches the handlers, which still register their routes
+// at the root. The prefix itself and / redirect to the dashboard, other paths
+// outside the prefix are not found.
+func basePathMiddleware(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix || r.URL.Path == "/" {
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		path, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + path
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = "/" + strings.TrimPrefix(r.URL.RawPath, prefix+"/")
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
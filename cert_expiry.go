@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Expiry states of a certificate
+const (
+	expiryOK      = "ok"
+	expiryWarning = "warning"
+	expiryExpired = "expired"
+)
+
+var defaultExpiryWarningDays = []int{30, 14, 7, 1}
+
+// CertificateExpiry describes the validity of a monitored certificate
+type CertificateExpiry struct {
+	Role     string    `json:"role"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+	State    string    `json:"state"`
+}
+
+// ExpiryMonitor logs warnings for certificates that are about to expire
+type ExpiryMonitor struct {
+	mutex  sync.Mutex
+	warned map[string]int
+}
+
+var expiryMonitor = &ExpiryMonitor{
+	warned: make(map[string]int),
+}
+
+// validateExpiryWarningDays checks the warning thresholds and sorts them descending
+func validateExpiryWarningDays(tlsConfig *TLSConfig) error {
+	if len(tlsConfig.ExpiryWarningDays) == 0 {
+		tlsConfig.ExpiryWarningDays = slices.Clone(defaultExpiryWarningDays)
+	}
+	for _, days := range tlsConfig.ExpiryWarningDays {
+		if days <= 0 {
+			return fmt.Errorf("tls.expiry_warning_days must be positive, got %d", days)
+		}
+	}
+	slices.Sort(tlsConfig.ExpiryWarningDays)
+	slices.Reverse(tlsConfig.ExpiryWarningDays)
+	return nil
+}
+
+// newCertificateExpiry computes the days to expiry and the state of a certificate
+func newCertificateExpiry(role string, cert *x509.Certificate, warningDays []int) CertificateExpiry {
+	daysLeft := int(math.Floor(time.Until(cert.NotAfter).Hours() / 24))
+	state := expiryOK
+	if time.Now().After(cert.NotAfter) {
+		state = expiryExpired
+	} else if len(warningDays) > 0 && daysLeft < warningDays[0] {
+		state = expiryWarning
+	}
+	return CertificateExpiry{
+		Role:     role,
+		Subject:  cert.Subject.CommonName,
+		NotAfter: cert.NotAfter,
+		DaysLeft: daysLeft,
+		State:    state,
+	}
+}
+
+// certificateExpiries returns the expiry of the server and CA certificates and,
+// if client certificate monitoring is enabled, of the client certificate of r
+func certificateExpiries(r *http.Request) []CertificateExpiry {
+	config := configManager.Get()
+	if !config.TLS.Enabled || certManager == nil {
+		return []CertificateExpiry{}
+	}
+
+	var expiries []CertificateExpiry
+	serverCerts, caCerts := certManager.GetCertificates()
+	for _, serverCert := range serverCerts {
+		expiries = append(expiries, newCertificateExpiry("server", serverCert, config.TLS.ExpiryWarningDays))
+	}
+	for _, ca := range caCerts {
+		expiries = append(expiries, newCertificateExpiry("ca", ca, config.TLS.ExpiryWarningDays))
+	}
+	if config.TLS.ClientCertExpiry && r != nil && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		expiries = append(expiries, newCertificateExpiry("client", r.TLS.PeerCertificates[0], config.TLS.ExpiryWarningDays))
+	}
+	return expiries
+}
+
+// Run checks the server and CA certificates every hour until ctx is cancelled
+func (em *ExpiryMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		for _, expiry := range certificateExpiries(nil) {
+			em.check(expiry, configManager.Get().TLS.ExpiryWarningDays)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckClient logs a warning if a presented client certificate is about to expire
+func (em *ExpiryMonitor) CheckClient(cert *x509.Certificate) {
+	config := configManager.Get()
+	if !config.TLS.ClientCertExpiry {
+		return
+	}
+	em.check(newCertificateExpiry("client", cert, config.TLS.ExpiryWarningDays), config.TLS.ExpiryWarningDays)
+}
+
+// check logs a warning once per certificate for each threshold that is crossed
+func (em *ExpiryMonitor) check(expiry CertificateExpiry, warningDays []int) {
+	if expiry.State == expiryOK {
+		return
+	}
+
+	// The smallest threshold the certificate is below of, 0 once it has expired
+	threshold := 0
+	for _, days := range warningDays {
+		if expiry.DaysLeft < days {
+			threshold = days
+		}
+	}
+	if expiry.State == expiryExpired {
+		threshold = 0
+	}
+
+	key := expiry.Role + "/" + expiry.Subject + "/" + expiry.NotAfter.String()
+	em.mutex.Lock()
+	last, seen := em.warned[key]
+	if seen && last <= threshold {
+		em.mutex.Unlock()
+		return
+	}
+	em.warned[key] = threshold
+	em.mutex.Unlock()
+
+	role := map[string]string{"server": "Server", "ca": "CA", "client": "Client"}[expiry.Role]
+	logger := slog.With("component", "cert-expiry", "role", expiry.Role, "subject", expiry.Subject, "not_after", expiry.NotAfter)
+	if expiry.State == expiryExpired {
+		logger.Warn(role + " certificate expired")
+		return
+	}
+	logger.Warn(role+" certificate expires soon", "days_left", expiry.DaysLeft)
+}
+
+// certificatesHandler returns the days to expiry of the monitored certificates
+func certificatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"warning_days": configManager.Get().TLS.ExpiryWarningDays,
+		"certificates": certificateExpiries(r),
+	})
+}
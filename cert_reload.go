@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Kubernetes secret and configmap volumes point every file at a "..data"
+// symlink, which is atomically swapped to a new "..<timestamp>" directory on
+// updates. No event mentions the files themselves when that happens.
+const kubernetesDataDir = "..data"
+
+// isKubernetesDataPath checks if a path is, or is inside, a "..data" link or
+// a "..<timestamp>" directory of a Kubernetes volume
+func isKubernetesDataPath(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == kubernetesDataDir || (strings.HasPrefix(part, "..") && part != "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHashes returns the SHA-256 hash of the content of every managed file,
+// following symlinks
+func (cm *CertificateManager) fileHashes() (map[string]string, error) {
+	hashes := make(map[string]string)
+	for _, file := range cm.files() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		sum := sha256.Sum256(data)
+		hashes[file] = hex.EncodeToString(sum[:])
+	}
+	return hashes, nil
+}
+
+// resolveFiles returns the final target of every managed file that is a symlink
+func (cm *CertificateManager) resolveFiles() map[string]string {
+	targets := make(map[string]string)
+	for _, file := range cm.files() {
+		if target, err := filepath.EvalSymlinks(file); err == nil {
+			targets[file] = target
+		}
+	}
+	return targets
+}
+
+// changedFiles returns the managed files whose content differs from the last
+// successful load. Files that cannot be read, e.g. in the middle of an
+// update, are not reported.
+func (cm *CertificateManager) changedFiles() []string {
+	hashes, err := cm.fileHashes()
+	if err != nil {
+		return nil
+	}
+
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	var changed []string
+	for _, file := range cm.files() {
+		if hashes[file] != cm.hashes[file] {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
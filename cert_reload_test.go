@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeKubernetesVolume writes certificates into a new "..<timestamp>"
+// directory of a Kubernetes volume in dir and atomically points "..data" at
+// it, the way the kubelet updates secrets
+func writeKubernetesVolume(t *testing.T, dir, timestamp string, ca, server *generatedCert) {
+	t.Helper()
+	dataDir := filepath.Join(dir, ".."+timestamp)
+	if err := os.Mkdir(dataDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCertificate(dataDir, "ca", ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCertificate(dataDir, "tls", server); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(".."+timestamp, tmpLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, kubernetesDataDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"ca.crt", "tls.crt", "tls.key"} {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err == nil {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(kubernetesDataDir, name), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKubernetesDataSwap(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test CA")
+	oldServer := newTestLeaf(t, ca, "old-server", x509.ExtKeyUsageServerAuth)
+	newServer := newTestLeaf(t, ca, "new-server", x509.ExtKeyUsageServerAuth)
+	writeKubernetesVolume(t, dir, "2026_01_01_00_00_00.000000001", ca, oldServer)
+
+	cm, err := NewCertificateManager(TLSConfig{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+		// Only file system events may trigger the reload
+		ReloadPollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	relevant := map[string]bool{
+		filepath.Join(dir, "tls.crt"):                                 true,
+		filepath.Join(dir, "..data"):                                  true,
+		filepath.Join(dir, "..data_tmp"):                              true,
+		filepath.Join(dir, "..2026_01_01_00_00_00.000000002"):         true,
+		filepath.Join(dir, "..2026_01_01_00_00_00.000000001/tls.crt"): true,
+		filepath.Join(dir, "unrelated.txt"):                           false,
+		filepath.Join(t.TempDir(), "..data"):                          false,
+	}
+	for path, want := range relevant {
+		if got := cm.isRelevantFile(path); got != want {
+			t.Errorf("isRelevantFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if changed := cm.changedFiles(); len(changed) != 0 {
+		t.Errorf("changedFiles() = %v before the update", changed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cm.watchForChanges(ctx)
+
+	writeKubernetesVolume(t, dir, "2026_01_01_00_00_00.000000002", ca, newServer)
+
+	// The file names are unchanged, only their content
+	changed := cm.changedFiles()
+	for _, file := range []string{filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")} {
+		if !slices.Contains(changed, file) {
+			t.Errorf("changedFiles() = %v, want %s", changed, file)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		serverCerts, _ := cm.GetCertificates()
+		if serverCerts[0].Subject.CommonName == "new-server" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server certificate %s was not reloaded after the ..data swap", serverCerts[0].Subject.CommonName)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if changed := cm.changedFiles(); len(changed) != 0 {
+		t.Errorf("changedFiles() = %v after the reload", changed)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+)
+
+// ClusterSettings holds the flattened settings returned by /_cluster/settings
+type ClusterSettings struct {
+	Persistent map[string]any `json:"persistent"`
+	Transient  map[string]any `json:"transient"`
+	Defaults   map[string]any `json:"defaults,omitempty"`
+}
+
+// fetchClusterSettings retrieves the current flat cluster settings from Elasticsearch,
+// optionally including the default value of every setting
+func fetchClusterSettings(ctx context.Context, includeDefaults bool) (*ClusterSettings, error) {
+	path := "/_cluster/settings?flat_settings=true"
+	if includeDefaults {
+		path += "&include_defaults=true"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, elasticsearchURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch cluster settings: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch cluster settings: HTTP %d", res.StatusCode)
+	}
+
+	var settings ClusterSettings
+	if err := json.NewDecoder(res.Body).Decode(&settings); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster settings: %v", err)
+	}
+	return &settings, nil
+}
+
+// Effective returns the value of a setting that is in effect together with the
+// layer it comes from. Transient values take precedence over persistent values,
+// which take precedence over defaults.
+func (cs *ClusterSettings) Effective(key string) (any, string) {
+	if v, ok := cs.Transient[key]; ok {
+		return v, "transient"
+	}
+	if v, ok := cs.Persistent[key]; ok {
+		return v, "persistent"
+	}
+	if v, ok := cs.Defaults[key]; ok {
+		return v, "default"
+	}
+	return nil, ""
+}
+
+// Apply returns a copy of the settings with the given changes applied.
+// A null value removes the setting from its layer.
+func (cs *ClusterSettings) Apply(changes []SettingsChange) *ClusterSettings {
+	after := &ClusterSettings{
+		Persistent: maps.Clone(cs.Persistent),
+		Transient:  maps.Clone(cs.Transient),
+		Defaults:   cs.Defaults,
+	}
+	if after.Persistent == nil {
+		after.Persistent = make(map[string]any)
+	}
+	if after.Transient == nil {
+		after.Transient = make(map[string]any)
+	}
+
+	for _, change := range changes {
+		layer := after.Persistent
+		if change.Scope == "transient" {
+			layer = after.Transient
+		}
+		if change.After == nil {
+			delete(layer, change.Key)
+		} else {
+			layer[change.Key] = change.After
+		}
+	}
+	return after
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings supported for responses
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// minCompressSize is the response size below which compression does not pay off
+const minCompressSize = 1024
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression); return w }}
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, 4) }}
+)
+
+// negotiateEncoding picks brotli or gzip from the Accept-Encoding header of
+// the request, or returns an empty string for an uncompressed response
+func negotiateEncoding(r *http.Request) string {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name != "" {
+			accepted[strings.ToLower(name)] = q
+		}
+	}
+
+	for _, encoding := range []string{encodingBrotli, encodingGzip} {
+		q, ok := accepted[encoding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > 0 {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// isCompressible reports whether a content type benefits from compression
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		mediaType == "application/javascript" ||
+		mediaType == "application/x-ndjson" ||
+		mediaType == "image/x-icon" ||
+		mediaType == "image/vnd.microsoft.icon" ||
+		mediaType == "image/svg+xml" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// compressWriter compresses the response if the client accepts it and the
+// content type and size are worth it. The decision is made on the first write.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	wroteHeader bool
+	encoder     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.decide(status)
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide sets up the encoder once the status and headers are known
+func (cw *compressWriter) decide(status int) {
+	header := cw.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" || !isCompressible(header.Get("Content-Type")) {
+		return
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < minCompressSize {
+		return
+	}
+
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", cw.encoding)
+	if etag := header.Get("ETag"); etag != "" {
+		header.Set("ETag", encodedETag(etag, cw.encoding))
+	}
+	switch cw.encoding {
+	case encodingBrotli:
+		bw := brotliWriters.Get().(*brotli.Writer)
+		bw.Reset(cw.ResponseWriter)
+		cw.encoder = bw
+	case encodingGzip:
+		gw := gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(cw.ResponseWriter)
+		cw.encoder = gw
+	}
+}
+
+// Flush supports streaming responses
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the compressed stream and returns the encoder to its pool
+func (cw *compressWriter) close() {
+	switch encoder := cw.encoder.(type) {
+	case *brotli.Writer:
+		encoder.Close()
+		brotliWriters.Put(encoder)
+	case *gzip.Writer:
+		encoder.Close()
+		gzipWriters.Put(encoder)
+	}
+}
+
+// compressMiddleware compresses responses with brotli or gzip as negotiated
+// with the client
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r)
+		if encoding == "" || r.Method == http.MethodHead {
+			w.Header().Add("Vary", "Accept-Encoding")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// encodedETag derives the ETag of a compressed representation, which must
+// differ from the uncompressed one
+func encodedETag(etag, encoding string) string {
+	if strings.HasSuffix(etag, `"`) {
+		return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+	}
+	return etag
+}
+
+// staticAsset is an embedded file together with its precompressed variants
+type staticAsset struct {
+	contentType string
+	etag        string
+	version     string
+	plain       []byte
+	encoded     map[string][]byte
+}
+
+// StaticAssets serves the embedded static files, precompressed at startup
+type StaticAssets struct {
+	assets map[string]*staticAsset
+}
+
+var staticAssets *StaticAssets
+
+// loadStaticAssets reads and compresses all files below root of fsys. Files
+// are served below /<root>/.
+func loadStaticAssets(fsys fs.FS, root string) (*StaticAssets, error) {
+	sa := &StaticAssets{assets: make(map[string]*staticAsset)}
+	var files []string
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		files = append(files, name)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list static files: %v", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		firstErr error
+	)
+	for _, name := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			asset, err := newStaticAsset(fsys, name)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			sa.assets["/"+name] = asset
+		}()
+	}
+	wg.Wait()
+	return sa, firstErr
+}
+
+// newStaticAsset reads an embedded file and compresses it if worthwhile
+func newStaticAsset(fsys fs.FS, name string) (*staticAsset, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static file %s: %v", name, err)
+	}
+
+	sum := sha256.Sum256(data)
+	version := hex.EncodeToString(sum[:8])
+	asset := &staticAsset{
+		contentType: mime.TypeByExtension(path.Ext(name)),
+		etag:        `"` + version + `"`,
+		version:     version,
+		plain:       data,
+		encoded:     make(map[string][]byte),
+	}
+	if asset.contentType == "" {
+		asset.contentType = http.DetectContentType(data)
+	}
+	if len(data) < minCompressSize || !isCompressible(asset.contentType) {
+		return asset, nil
+	}
+
+	var gz bytes.Buffer
+	gw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	gw.Write(data)
+	gw.Close()
+
+	// Level 11 takes seconds for the bundled scripts at startup for little gain
+	var br bytes.Buffer
+	bw := brotli.NewWriterLevel(&br, 9)
+	bw.Write(data)
+	bw.Close()
+
+	// Keep only variants that save at least 5%, e.g. not for PNG icons
+	worthwhile := len(data) * 95 / 100
+	if gz.Len() < worthwhile {
+		asset.encoded[encodingGzip] = gz.Bytes()
+	}
+	if br.Len() < worthwhile {
+		asset.encoded[encodingBrotli] = br.Bytes()
+	}
+	return asset, nil
+}
+
+// ServeHTTP serves a static file in the negotiated encoding. Requests with the
+// current version in the v query parameter may be cached forever, others are
+// revalidated with the ETag.
+func (sa *StaticAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	asset, ok := sa.assets[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", asset.contentType)
+	header.Add("Vary", "Accept-Encoding")
+	if r.URL.Query().Get("v") == asset.version {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	content, etag := asset.plain, asset.etag
+	if encoding := negotiateEncoding(r); encoding != "" {
+		if encoded, ok := asset.encoded[encoding]; ok {
+			content, etag = encoded, encodedETag(asset.etag, encoding)
+			header.Set("Content-Encoding", encoding)
+		}
+	}
+	header.Set("ETag", etag)
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(content))
+}
+
+// URL returns the URL of a static file below the base path with its version
+// as a query parameter, so browsers fetch new files after an upgrade
+func (sa *StaticAssets) URL(name string) (string, error) {
+	asset, ok := sa.assets[name]
+	if !ok {
+		return "", fmt.Errorf("unknown static file %s", name)
+	}
+	return withBasePath(name) + "?v=" + asset.version, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ConfigManager holds the active configuration and reloads it when the config
+// file changes or the process receives SIGHUP
+type ConfigManager struct {
+	configFile string
+	current    atomic.Pointer[Config]
+	watcher    *fsnotify.Watcher
+	signals    chan os.Signal
+	logger     *slog.Logger
+}
+
+// NewConfigManager loads the configuration and, if a config file is given,
+// prepares watching it for changes. Reloading starts with watchForChanges.
+func NewConfigManager(configFile string) (*ConfigManager, error) {
+	cm := &ConfigManager{
+		configFile: configFile,
+		logger:     slog.With("component", "config-manager"),
+	}
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	cm.current.Store(cfg)
+
+	if configFile == "" {
+		return cm, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config file watcher: %v", err)
+	}
+	cm.watcher = watcher
+
+	// Watch the directory, editors and config management tools often replace files atomically
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch config directory %s: %v", filepath.Dir(configFile), err)
+	}
+
+	cm.signals = make(chan os.Signal, 1)
+	signal.Notify(cm.signals, syscall.SIGHUP)
+
+	cm.logger.Info("Configuration manager initialized, reload with SIGHUP", "file", configFile)
+	return cm, nil
+}
+
+// Get returns the active configuration. The returned value must not be modified.
+func (cm *ConfigManager) Get() *Config {
+	return cm.current.Load()
+}
+
+// watchForChanges reloads the configuration on file changes and SIGHUP until
+// ctx is cancelled
+func (cm *ConfigManager) watchForChanges(ctx context.Context) {
+	if cm.watcher == nil {
+		return
+	}
+
+	// Debounce rapid file changes (common with atomic file replacements)
+	debounceTimer := time.NewTimer(0)
+	if !debounceTimer.Stop() {
+		<-debounceTimer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-cm.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(cm.configFile) {
+				cm.logger.Debug("File system event", "op", event.Op.String(), "file", event.Name)
+				debounceTimer.Reset(500 * time.Millisecond)
+			}
+
+		case err, ok := <-cm.watcher.Errors:
+			if !ok {
+				return
+			}
+			cm.logger.Error("Watcher error", "error", err)
+
+		case <-cm.signals:
+			cm.logger.Info("Received SIGHUP, reloading configuration")
+			cm.Reload()
+
+		case <-debounceTimer.C:
+			cm.logger.Info("Config file changed, reloading")
+			cm.Reload()
+		}
+	}
+}
+
+// Reload reads and validates the config file and swaps it in. An invalid
+// config is rejected and the previous config stays active.
+func (cm *ConfigManager) Reload() error {
+	cfg, err := loadConfig(cm.configFile)
+	if err != nil {
+		cm.logger.Error("Rejected new configuration, keeping the previous one", "error", err)
+		return err
+	}
+
+	old := cm.current.Swap(cfg)
+	for _, setting := range restartRequiredChanges(old, cfg) {
+		cm.logger.Warn("Changed setting only takes effect after a restart", "setting", setting)
+	}
+	cm.logger.Info("Configuration reloaded successfully")
+	return nil
+}
+
+// restartRequiredChanges lists changed settings that are only read at startup
+func restartRequiredChanges(old, cfg *Config) []string {
+	var changed []string
+	// server.allowed_origins is read per request
+	oldServer, newServer := old.Server, cfg.Server
+	oldServer.AllowedOrigins, newServer.AllowedOrigins = nil, nil
+	if !reflect.DeepEqual(oldServer, newServer) {
+		changed = append(changed, "server (except allowed_origins)")
+	}
+	if old.TLS.Enabled != cfg.TLS.Enabled || old.TLS.CAFile != cfg.TLS.CAFile ||
+		old.TLS.CertFile != cfg.TLS.CertFile || old.TLS.KeyFile != cfg.TLS.KeyFile ||
+		!slices.Equal(old.TLS.CRLFiles, cfg.TLS.CRLFiles) || old.TLS.OCSP != cfg.TLS.OCSP ||
+		old.TLS.ReloadPollInterval != cfg.TLS.ReloadPollInterval || !slices.Equal(old.TLS.Certificates, cfg.TLS.Certificates) {
+		changed = append(changed, "tls (except allowed_cns)")
+	}
+	if !reflect.DeepEqual(old.OIDC, cfg.OIDC) {
+		changed = append(changed, "oidc")
+	}
+	if old.Health != cfg.Health {
+		changed = append(changed, "health")
+	}
+	if old.History != cfg.History {
+		changed = append(changed, "history")
+	}
+	return changed
+}
+
+// Close stops watching the config file
+func (cm *ConfigManager) Close() error {
+	if cm.watcher == nil {
+		return nil
+	}
+	signal.Stop(cm.signals)
+	return cm.watcher.Close()
+}
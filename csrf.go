@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// csrfHeader must be present on mutating proxy requests. Browsers only send
+// custom headers cross-origin after a CORS preflight, which the board never
+// allows, so a foreign page cannot forge such a request.
+const csrfHeader = "X-Requested-By"
+
+// errUnsupportedMediaType is returned for request bodies that are not JSON
+var errUnsupportedMediaType = errors.New("Content-Type must be application/json")
+
+// proxiedMethods are the Elasticsearch methods /proxy forwards
+var proxiedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+
+// isMutatingMethod reports whether an Elasticsearch method may change data
+func isMutatingMethod(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead
+}
+
+// validateAllowedOrigins normalizes server.allowed_origins to scheme://host
+func validateAllowedOrigins(origins []string) error {
+	for i, origin := range origins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("server.allowed_origins: %q is not an origin like https://board.example.com", origin)
+		}
+		origins[i] = strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+	return nil
+}
+
+// checkCSRF rejects cross-site requests that would change Elasticsearch
+// data: they must carry the custom header and, if the browser sent an Origin
+// or Referer, come from the board itself or one of server.allowed_origins
+func checkCSRF(r *http.Request, allowedOrigins []string) error {
+	if r.Header.Get(csrfHeader) == "" {
+		return fmt.Errorf("missing %s header", csrfHeader)
+	}
+
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	// Clients other than browsers send neither
+	if source == "" {
+		return nil
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid origin %q", source)
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	if slices.Contains(allowedOrigins, strings.ToLower(u.Scheme+"://"+u.Host)) {
+		return nil
+	}
+	return fmt.Errorf("cross-origin request from %s", u.Scheme+"://"+u.Host)
+}
+
+// decodeStrictJSON decodes a single JSON object from a request and rejects
+// other content types, unknown fields and trailing data
+func decodeStrictJSON(r *http.Request, v any) error {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return errUnsupportedMediaType
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the JSON object")
+	}
+	return nil
+}
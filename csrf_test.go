@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	allowedOrigins := []string{"https://ops.example.com"}
+
+	tests := []struct {
+		name    string
+		header  bool // whether the request carries the CSRF header
+		origin  string
+		referer string
+		wantErr bool
+	}{
+		{"header without origin", true, "", "", false},
+		{"missing header", false, "", "", true},
+		{"missing header from own origin", false, "https://board.example.com", "", true},
+		{"own origin", true, "https://board.example.com", "", false},
+		{"own origin other case", true, "https://BOARD.example.com", "", false},
+		{"own origin over http", true, "http://board.example.com", "", false},
+		{"foreign origin", true, "https://attacker.example", "", true},
+		{"foreign origin with own host as subdomain", true, "https://board.example.com.attacker.example", "", true},
+		{"own host on another port", true, "https://board.example.com:8443", "", true},
+		{"null origin", true, "null", "", true},
+		{"allowed origin", true, "https://ops.example.com", "", false},
+		{"allowed origin other case", true, "https://OPS.example.com", "", false},
+		{"allowed host with other scheme", true, "http://ops.example.com", "", true},
+		{"own referer", true, "", "https://board.example.com/indices?x=1", false},
+		{"foreign referer", true, "", "https://attacker.example/page", true},
+		{"allowed referer", true, "", "https://ops.example.com/tools/", false},
+		{"relative referer", true, "", "/indices", true},
+		{"origin wins over referer", true, "https://attacker.example", "https://board.example.com/", true},
+		{"own origin with foreign referer", true, "https://board.example.com", "https://attacker.example/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "https://board.example.com/proxy", nil)
+			if tt.header {
+				r.Header.Set(csrfHeader, "go-elastic-board")
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			err := checkCSRF(r, allowedOrigins)
+			if tt.wantErr && err == nil {
+				t.Errorf("checkCSRF accepted origin %q, referer %q", tt.origin, tt.referer)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("checkCSRF failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   string // empty if the origin must be rejected
+	}{
+		{"https://ops.example.com", "https://ops.example.com"},
+		{"https://OPS.example.com/", "https://ops.example.com"},
+		{"http://localhost:8080", "http://localhost:8080"},
+		{"ops.example.com", ""},
+		{"https://ops.example.com/tools", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		origins := []string{tt.origin}
+		err := validateAllowedOrigins(origins)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("validateAllowedOrigins accepted %q", tt.origin)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("validateAllowedOrigins(%q) failed: %v", tt.origin, err)
+		} else if origins[0] != tt.want {
+			t.Errorf("validateAllowedOrigins(%q) = %q, want %q", tt.origin, origins[0], tt.want)
+		}
+	}
+}
+
+func TestDecodeStrictJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     bool
+	}{
+		{"valid", "application/json", `{"path":"/_cluster/health","method":"GET"}`, false},
+		{"charset parameter", "application/json; charset=utf-8", `{"path":"/"}`, false},
+		{"trailing whitespace", "application/json", "{\"path\":\"/\"}\n", false},
+		{"missing content type", "", `{"path":"/"}`, true},
+		{"form content type", "application/x-www-form-urlencoded", `{"path":"/"}`, true},
+		{"text content type", "text/plain", `{"path":"/"}`, true},
+		{"unknown field", "application/json", `{"path":"/","methods":"DELETE"}`, true},
+		{"trailing object", "application/json", `{"path":"/"}{"path":"/x"}`, true},
+		{"trailing garbage", "application/json", `{"path":"/"}x`, true},
+		{"array", "application/json", `[{"path":"/"}]`, true},
+		{"empty body", "application/json", ``, true},
+		{"wrong type", "application/json", `{"path":1}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/proxy", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var v struct {
+				Path   string `json:"path"`
+				Method string `json:"method,omitempty"`
+			}
+			err := decodeStrictJSON(r, &v)
+			if tt.wantErr && err == nil {
+				t.Errorf("decodeStrictJSON accepted %q as %+v", tt.body, v)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("decodeStrictJSON failed: %v", err)
+			}
+		})
+	}
+
+	// Content types are reported apart, they are answered with 415
+	r := httptest.NewRequest("POST", "/proxy", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "text/plain")
+	if err := decodeStrictJSON(r, &struct{}{}); !errors.Is(err, errUnsupportedMediaType) {
+		t.Errorf("decodeStrictJSON with text/plain = %v, want %v", err, errUnsupportedMediaType)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// generatedCert is a certificate created by gen-certs together with its key
+type generatedCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// genCertsCommand implements the gen-certs subcommand, which creates a
+// throwaway CA, a server certificate and client certificates for testing TLS mode
+func genCertsCommand(args []string) error {
+	fs := flag.NewFlagSet("gen-certs", flag.ExitOnError)
+	outDir := fs.String("out", "certs", "directory to write the certificates to")
+	hosts := fs.String("hosts", "localhost,127.0.0.1,::1", "comma separated DNS names and IP addresses of the server certificate")
+	clients := fs.String("clients", "admin", "comma separated common names of the client certificates")
+	days := fs.Int("days", 365, "validity of the certificates in days")
+	p12Password := fs.String("p12-password", "changeit", "password of the PKCS#12 bundles for browsers")
+	force := fs.Bool("force", false, "overwrite existing files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s gen-certs [options]\n\nGenerates a self-signed CA, a server certificate and client certificates for development.\n\nOptions:\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	serverNames := splitList(*hosts)
+	clientNames := splitList(*clients)
+	if len(serverNames) == 0 {
+		return fmt.Errorf("-hosts must not be empty")
+	}
+	if *days <= 0 {
+		return fmt.Errorf("-days must be positive")
+	}
+
+	if err := validateClientNames(clientNames); err != nil {
+		return err
+	}
+	files := []string{"ca.crt", "ca.key", "server.crt", "server.key"}
+	for _, name := range clientNames {
+		files = append(files, name+".crt", name+".key", name+".p12")
+	}
+	if !*force {
+		for _, file := range files {
+			if _, err := os.Stat(filepath.Join(*outDir, file)); err == nil {
+				return fmt.Errorf("%s already exists, use -force to overwrite", filepath.Join(*outDir, file))
+			}
+		}
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", *outDir, err)
+	}
+
+	validity := time.Duration(*days) * 24 * time.Hour
+
+	ca, err := generateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "go-elastic-board development CA", Organization: []string{"go-elastic-board"}},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, validity, nil)
+	if err != nil {
+		return err
+	}
+	if err := writeCertificate(*outDir, "ca", ca); err != nil {
+		return err
+	}
+
+	serverTemplate := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: serverNames[0], Organization: []string{"go-elastic-board"}},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range serverNames {
+		if ip := net.ParseIP(host); ip != nil {
+			serverTemplate.IPAddresses = append(serverTemplate.IPAddresses, ip)
+		} else {
+			serverTemplate.DNSNames = append(serverTemplate.DNSNames, host)
+		}
+	}
+	server, err := generateCertificate(serverTemplate, validity, ca)
+	if err != nil {
+		return err
+	}
+	if err := writeCertificate(*outDir, "server", server); err != nil {
+		return err
+	}
+
+	for _, name := range clientNames {
+		client, err := generateCertificate(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: name, Organization: []string{"go-elastic-board"}},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, validity, ca)
+		if err != nil {
+			return err
+		}
+		if err := writeCertificate(*outDir, name, client); err != nil {
+			return err
+		}
+
+		bundle, err := pkcs12.Modern.Encode(client.key, client.cert, []*x509.Certificate{ca.cert}, *p12Password)
+		if err != nil {
+			return fmt.Errorf("failed to create PKCS#12 bundle for %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(*outDir, name+".p12"), bundle, 0o600); err != nil {
+			return fmt.Errorf("failed to write PKCS#12 bundle for %s: %v", name, err)
+		}
+	}
+
+	absDir, err := filepath.Abs(*outDir)
+	if err != nil {
+		absDir = *outDir
+	}
+	fmt.Printf("Generated development certificates in %s, valid for %d days:\n", absDir, *days)
+	fmt.Printf("  CA:      ca.crt, ca.key\n")
+	fmt.Printf("  Server:  server.crt, server.key (%s)\n", strings.Join(serverNames, ", "))
+	for _, name := range clientNames {
+		fmt.Printf("  Client:  %s.crt, %s.key, %s.p12 (password %q)\n", name, name, name, *p12Password)
+	}
+	fmt.Printf("\nImport a .p12 bundle into your browser and add the following to your config file:\n\n")
+	fmt.Printf("tls:\n")
+	fmt.Printf("  enabled: true\n")
+	fmt.Printf("  ca_file: %q\n", filepath.Join(absDir, "ca.crt"))
+	fmt.Printf("  cert_file: %q\n", filepath.Join(absDir, "server.crt"))
+	fmt.Printf("  key_file: %q\n", filepath.Join(absDir, "server.key"))
+	fmt.Printf("  allowed_cns:\n")
+	for _, name := range clientNames {
+		fmt.Printf("    - %q\n", name)
+	}
+	fmt.Printf("\nThese certificates are for development only, do not use them in production.\n")
+	return nil
+}
+
+// validateClientNames rejects client names that are not plain file names or
+// whose files would overwrite the CA, the server or another client. Names are
+// compared ignoring case, as file systems on macOS and Windows do.
+func validateClientNames(names []string) error {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid client name %q", name)
+		}
+		key := strings.ToLower(name)
+		if key == "ca" || key == "server" {
+			return fmt.Errorf("client name %q is reserved for the %s certificate", name, key)
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate client name %q", name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// generateCertificate creates a key pair and a certificate from the template,
+// signed by the issuer or self-signed if the issuer is nil
+func generateCertificate(template *x509.Certificate, validity time.Duration, issuer *generatedCert) (*generatedCert, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(validity)
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate %s: %v", template.Subject.CommonName, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &generatedCert{cert: cert, key: key}, nil
+}
+
+// writeCertificate writes the certificate and key as <name>.crt and <name>.key
+func writeCertificate(dir, name string, gc *generatedCert) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(gc.key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key of %s: %v", name, err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: gc.cert.Raw})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s.crt: %v", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s.key: %v", name, err)
+	}
+	return nil
+}
+
+// splitList splits a comma separated list and drops empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
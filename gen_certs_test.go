@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateClientNames(t *testing.T) {
+	tests := []struct {
+		names   []string
+		wantErr bool
+	}{
+		{[]string{"admin"}, false},
+		{[]string{"alice", "bob", "ops.team"}, false},
+		{[]string{"ca"}, true},
+		{[]string{"server"}, true},
+		{[]string{"CA"}, true},
+		{[]string{"Server"}, true},
+		{[]string{"alice", "alice"}, true},
+		{[]string{"alice", "Alice"}, true},
+		{[]string{"."}, true},
+		{[]string{".."}, true},
+		{[]string{"../alice"}, true},
+		{[]string{`..\alice`}, true},
+		{[]string{"a/b"}, true},
+	}
+
+	for _, tt := range tests {
+		err := validateClientNames(tt.names)
+		if tt.wantErr && err == nil {
+			t.Errorf("validateClientNames(%q) accepted the names", tt.names)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("validateClientNames(%q) failed: %v", tt.names, err)
+		}
+	}
+}
+
+func TestGenCertsCommandKeepsCA(t *testing.T) {
+	dir := t.TempDir()
+	if err := genCertsCommand([]string{"-out", dir, "-clients", "ca"}); err == nil {
+		t.Fatal("gen-certs accepted the client name ca")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ca.crt")); err == nil {
+		t.Error("gen-certs wrote files before rejecting the client names")
+	}
+}
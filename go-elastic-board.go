@@ -6,19 +6,19 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"embed" // Import the embed package
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"maps"
 	"net/http"
 	"os"
-	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -28,25 +28,72 @@ import (
 //go:embed static
 var staticDir embed.FS
 
+//go:embed templates
+var templatesDir embed.FS
+
 // TLSConfig holds the TLS configuration for client certificate authentication
 type TLSConfig struct {
-	Enabled    bool     `yaml:"enabled" default:"true"`
-	CAFile     string   `yaml:"ca_file"`
-	CertFile   string   `yaml:"cert_file"`
-	KeyFile    string   `yaml:"key_file"`
-	AllowedCNs []string `yaml:"allowed_cns"`
+	Enabled    bool       `yaml:"enabled" default:"true"`
+	CAFile     string     `yaml:"ca_file"`
+	CertFile   string     `yaml:"cert_file"`
+	KeyFile    string     `yaml:"key_file"`
+	AllowedCNs []string   `yaml:"allowed_cns"`
+	CRLFiles   []string   `yaml:"crl_files"`
+	OCSP       OCSPConfig `yaml:"ocsp"`
+
+	// IdentityRules allow clients by subject, SAN or fingerprint in addition to AllowedCNs
+	IdentityRules []IdentityRule `yaml:"identity_rules"`
+	// AllowAnyValidCert allows every certificate signed by the CA
+	AllowAnyValidCert bool `yaml:"allow_any_valid_cert"`
+
+	// ExpiryWarningDays are the days before expiry at which certificate warnings are logged
+	ExpiryWarningDays []int `yaml:"expiry_warning_days"`
+	// ClientCertExpiry also monitors the expiry of presented client certificates
+	ClientCertExpiry bool `yaml:"client_cert_expiry"`
+	// ReloadPollInterval is the interval of the content check of the certificate files
+	ReloadPollInterval time.Duration `yaml:"reload_poll_interval"`
+	// Certificates are additional server certificates chosen by SNI server name
+	Certificates []CertificatePair `yaml:"certificates"`
+}
+
+// CertificatePair is a server certificate and its private key
+type CertificatePair struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
 }
 
 // ServerConfig holds the server configuration
 type ServerConfig struct {
-	Address string `yaml:"address"`
-	Port    string `yaml:"port"`
+	Address           string        `yaml:"address"`
+	Port              string        `yaml:"port"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	// AllowedOrigins are origins besides the board's own host that may send
+	// mutating requests, e.g. when a reverse proxy rewrites the Host header
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// BasePath serves all routes below a prefix, e.g. /tools/es-board behind
+	// a shared reverse proxy
+	BasePath string `yaml:"base_path"`
+}
+
+// HistoryConfig holds the configuration of the cluster settings change history
+type HistoryConfig struct {
+	File       string `yaml:"file"`
+	MaxEntries int    `yaml:"max_entries"`
 }
 
 // Config holds the application configuration
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	TLS    TLSConfig    `yaml:"tls"`
+	Server    ServerConfig    `yaml:"server"`
+	TLS       TLSConfig       `yaml:"tls"`
+	ProxyAuth ProxyAuthConfig `yaml:"proxy_auth"`
+	OIDC      OIDCConfig      `yaml:"oidc"`
+	Health    HealthConfig    `yaml:"health"`
+	History   HistoryConfig   `yaml:"history"`
+	Proxy     ProxyConfig     `yaml:"proxy"`
 }
 
 // CertificateManager handles automatic reloading of TLS certificates
@@ -54,29 +101,45 @@ type CertificateManager struct {
 	certFile    string
 	keyFile     string
 	caFile      string
+	crlFiles    []string
+	sniPairs    []CertificatePair
 	certificate *tls.Certificate
+	sniCerts    []*tls.Certificate
 	caCertPool  *x509.CertPool
+	caCerts     []*x509.Certificate
+	revoked     map[string]time.Time
 	mutex       sync.RWMutex
 	watcher     *fsnotify.Watcher
-	logger      *log.Logger
+	logger      *slog.Logger
+
+	// pollInterval is the interval of the content hash check that catches
+	// changes the file watcher misses, e.g. Kubernetes symlink swaps
+	pollInterval time.Duration
+	hashes       map[string]string
+	targets      map[string]string
 }
 
+// elasticsearchURL is the Elasticsearch endpoint all proxied requests are sent to
+const elasticsearchURL = "http://localhost:9200"
+
 var (
-	buildversion string
-	buildtime    string
-	debug        bool
-	verbose      bool
-	config       Config
-	certManager  *CertificateManager
+	buildversion  string
+	buildtime     string
+	configManager *ConfigManager
+	certManager   *CertificateManager
 )
 
-// NewCertificateManager creates a new certificate manager with file watching
-func NewCertificateManager(certFile, keyFile, caFile string) (*CertificateManager, error) {
+// NewCertificateManager creates a new certificate manager with file watching.
+// Reloading starts with watchForChanges.
+func NewCertificateManager(tlsConfig TLSConfig) (*CertificateManager, error) {
 	cm := &CertificateManager{
-		certFile: certFile,
-		keyFile:  keyFile,
-		caFile:   caFile,
-		logger:   log.New(os.Stdout, "[CertManager] ", log.LstdFlags),
+		certFile:     tlsConfig.CertFile,
+		keyFile:      tlsConfig.KeyFile,
+		caFile:       tlsConfig.CAFile,
+		crlFiles:     tlsConfig.CRLFiles,
+		sniPairs:     tlsConfig.Certificates,
+		logger:       slog.With("component", "cert-manager"),
+		pollInterval: tlsConfig.ReloadPollInterval,
 	}
 
 	// Initial load of certificates
@@ -97,24 +160,44 @@ func NewCertificateManager(certFile, keyFile, caFile string) (*CertificateManage
 		return nil, fmt.Errorf("failed to watch certificate files: %v", err)
 	}
 
-	// Start watching for file changes in a goroutine
-	go cm.watchForChanges()
-
-	cm.logger.Printf("Certificate manager initialized, watching: %s, %s, %s", certFile, keyFile, caFile)
+	cm.logger.Info("Certificate manager initialized", "files", cm.files())
 	return cm, nil
 }
 
-// loadCertificates loads the server certificate, key, and CA certificate
+// files returns all certificate and CRL files managed by the certificate manager
+func (cm *CertificateManager) files() []string {
+	files := []string{cm.certFile, cm.keyFile, cm.caFile}
+	for _, pair := range cm.sniPairs {
+		files = append(files, pair.CertFile, pair.KeyFile)
+	}
+	return append(files, cm.crlFiles...)
+}
+
+// loadCertificates loads the server certificate, key, CA certificate and CRLs
 func (cm *CertificateManager) loadCertificates() error {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
-	// Load server certificate and key
-	cert, err := tls.LoadX509KeyPair(cm.certFile, cm.keyFile)
+	// Remember file contents and symlink targets to detect changes the watcher misses
+	hashes, err := cm.fileHashes()
 	if err != nil {
-		return fmt.Errorf("failed to load server certificate: %v", err)
+		return err
+	}
+	targets := cm.resolveFiles()
+
+	// Load the default and the SNI server certificates
+	cert, err := cm.loadServerCertificate(CertificatePair{CertFile: cm.certFile, KeyFile: cm.keyFile})
+	if err != nil {
+		return err
+	}
+	var sniCerts []*tls.Certificate
+	for _, pair := range cm.sniPairs {
+		sniCert, err := cm.loadServerCertificate(pair)
+		if err != nil {
+			return err
+		}
+		sniCerts = append(sniCerts, sniCert)
 	}
-	cm.certificate = &cert
 
 	// Load CA certificate
 	caCert, err := os.ReadFile(cm.caFile)
@@ -126,17 +209,53 @@ func (cm *CertificateManager) loadCertificates() error {
 	if !caCertPool.AppendCertsFromPEM(caCert) {
 		return fmt.Errorf("failed to parse CA certificate")
 	}
+	caCerts, err := parseCertificates(caCert)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	// Load certificate revocation lists
+	revoked, err := loadCRLs(cm.crlFiles, caCerts)
+	if err != nil {
+		return err
+	}
+
+	// Swap everything at once, so a failed reload keeps the previous state
+	cm.hashes = hashes
+	cm.targets = targets
+	cm.certificate = cert
+	cm.sniCerts = sniCerts
 	cm.caCertPool = caCertPool
+	cm.caCerts = caCerts
+	cm.revoked = revoked
 
-	cm.logger.Printf("Certificates loaded successfully")
+	cm.logger.Info("Certificates loaded successfully")
 	return nil
 }
 
+// loadServerCertificate loads a server certificate and its key. The caller must
+// hold the mutex.
+func (cm *CertificateManager) loadServerCertificate(pair CertificatePair) (*tls.Certificate, error) {
+	// This fails if the key does not match the certificate
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate %s: %v", pair.CertFile, err)
+	}
+
+	// Never replace a working certificate with an expired one
+	if time.Now().After(cert.Leaf.NotAfter) {
+		if cm.certificate != nil {
+			return nil, fmt.Errorf("refusing to load server certificate %s, it expired at %s",
+				pair.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+		}
+		cm.logger.Warn("Server certificate expired", "file", pair.CertFile, "not_after", cert.Leaf.NotAfter)
+	}
+	return &cert, nil
+}
+
 // watchFiles adds certificate files to the file watcher
 func (cm *CertificateManager) watchFiles() error {
-	files := []string{cm.certFile, cm.keyFile, cm.caFile}
-
-	for _, file := range files {
+	for _, file := range cm.files() {
 		// Watch the directory containing the file (some tools replace files atomically)
 		dir := filepath.Dir(file)
 		if err := cm.watcher.Add(dir); err != nil {
@@ -145,15 +264,27 @@ func (cm *CertificateManager) watchFiles() error {
 
 		// Also watch the file itself
 		if err := cm.watcher.Add(file); err != nil {
-			cm.logger.Printf("Warning: failed to watch file %s directly: %v", file, err)
+			cm.logger.Warn("Failed to watch file directly", "file", file, "error", err)
+		}
+
+		// Watch the directory of a symlink target, unless it is a Kubernetes
+		// timestamped directory that is removed on the next update
+		cm.mutex.RLock()
+		target := cm.targets[file]
+		cm.mutex.RUnlock()
+		if targetDir := filepath.Dir(target); target != "" && target != file && targetDir != dir && !isKubernetesDataPath(targetDir) {
+			if err := cm.watcher.Add(targetDir); err != nil {
+				cm.logger.Warn("Failed to watch symlink target directory", "dir", targetDir, "error", err)
+			}
 		}
 	}
 
 	return nil
 }
 
-// watchForChanges monitors file system events and reloads certificates when needed
-func (cm *CertificateManager) watchForChanges() {
+// watchForChanges monitors file system events and reloads certificates when
+// needed, until ctx is cancelled
+func (cm *CertificateManager) watchForChanges(ctx context.Context) {
 	defer cm.watcher.Close()
 
 	// Debounce rapid file changes (common with atomic file replacements)
@@ -162,8 +293,21 @@ func (cm *CertificateManager) watchForChanges() {
 		<-debounceTimer.C
 	}
 
+	// Fall back to comparing file contents periodically
+	pollTicker := time.NewTicker(cm.pollInterval)
+	defer pollTicker.Stop()
+
 	for {
 		select {
+		case <-ctx.Done():
+			return
+
+		case <-pollTicker.C:
+			if changed := cm.changedFiles(); len(changed) > 0 {
+				cm.logger.Info("Content changed without a file system event, reloading", "files", changed)
+				cm.reload()
+			}
+
 		case event, ok := <-cm.watcher.Events:
 			if !ok {
 				return
@@ -171,9 +315,7 @@ func (cm *CertificateManager) watchForChanges() {
 
 			// Check if the event affects any of our certificate files
 			if cm.isRelevantFile(event.Name) {
-				if debug {
-					cm.logger.Printf("File system event: %s %s", event.Op.String(), event.Name)
-				}
+				cm.logger.Debug("File system event", "op", event.Op.String(), "file", event.Name)
 
 				// Reset the debounce timer
 				debounceTimer.Reset(500 * time.Millisecond)
@@ -183,35 +325,67 @@ func (cm *CertificateManager) watchForChanges() {
 			if !ok {
 				return
 			}
-			cm.logger.Printf("Watcher error: %v", err)
+			cm.logger.Error("Watcher error", "error", err)
 
 		case <-debounceTimer.C:
 			// Reload certificates after debounce period
-			cm.logger.Printf("Certificate files changed, reloading...")
-			if err := cm.loadCertificates(); err != nil {
-				cm.logger.Printf("Failed to reload certificates: %v", err)
-			} else {
-				cm.logger.Printf("Certificates reloaded successfully")
-			}
+			cm.logger.Info("Certificate files changed, reloading")
+			cm.reload()
 		}
 	}
 }
 
-// isRelevantFile checks if a file path is one of our certificate files
+// reload loads the certificates and renews the watches, which are lost when
+// a watched file or symlink target is replaced
+func (cm *CertificateManager) reload() {
+	if err := cm.loadCertificates(); err != nil {
+		cm.logger.Error("Failed to reload certificates", "error", err)
+		return
+	}
+	if err := cm.watchFiles(); err != nil {
+		cm.logger.Warn("Failed to renew file watches", "error", err)
+	}
+	cm.logger.Info("Certificates reloaded successfully")
+}
+
+// isRelevantFile checks if a file path is one of our certificate files, the
+// target of one of their symlinks, or a Kubernetes ..data symlink swap
 func (cm *CertificateManager) isRelevantFile(filePath string) bool {
-	files := []string{cm.certFile, cm.keyFile, cm.caFile}
-	for _, file := range files {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	for _, file := range cm.files() {
 		if filePath == file || filepath.Base(filePath) == filepath.Base(file) {
 			return true
 		}
+		if target := cm.targets[file]; filePath == target {
+			return true
+		}
+		if filepath.Dir(filePath) == filepath.Dir(file) && isKubernetesDataPath(filePath) {
+			return true
+		}
 	}
 	return false
 }
 
-// GetCertificate returns the current server certificate for TLS configuration
-func (cm *CertificateManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+// GetCertificate returns the server certificate matching the SNI server name
+// of the client, or the default certificate. The certificates of
+// tls.certificates are tried first, so a wildcard default certificate does
+// not shadow a more specific one.
+func (cm *CertificateManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	cm.mutex.RLock()
 	defer cm.mutex.RUnlock()
+
+	if hello != nil && hello.ServerName != "" {
+		for _, cert := range cm.sniCerts {
+			if cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return cert, nil
+			}
+		}
+		if cm.certificate.Leaf.VerifyHostname(hello.ServerName) != nil {
+			cm.logger.Debug("No certificate for server name, using the default certificate", "server_name", hello.ServerName)
+		}
+	}
 	return cm.certificate, nil
 }
 
@@ -222,6 +396,66 @@ func (cm *CertificateManager) GetCACertPool() *x509.CertPool {
 	return cm.caCertPool
 }
 
+// GetCertificates returns the current server certificates, the default one
+// first, and the CA certificates
+func (cm *CertificateManager) GetCertificates() ([]*x509.Certificate, []*x509.Certificate) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	if cm.certificate == nil {
+		return nil, cm.caCerts
+	}
+	serverCerts := []*x509.Certificate{cm.certificate.Leaf}
+	for _, cert := range cm.sniCerts {
+		serverCerts = append(serverCerts, cert.Leaf)
+	}
+	return serverCerts, cm.caCerts
+}
+
+// TLSConfig returns a server TLS config that applies the current server
+// certificate and CA pool to every handshake, so reloaded files take effect
+// without a restart
+func (cm *CertificateManager) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	config := &tls.Config{
+		ClientAuth:     clientAuth,
+		ClientCAs:      cm.GetCACertPool(),
+		GetCertificate: cm.GetCertificate,
+	}
+
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		handshakeConfig := config.Clone()
+		handshakeConfig.ClientCAs = cm.GetCACertPool()
+		return handshakeConfig, nil
+	}
+
+	// Resumed sessions skip certificate verification, so check the client
+	// certificate against the current CA pool in case it was rotated
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if !state.DidResume || len(state.PeerCertificates) == 0 {
+			return nil
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         cm.GetCACertPool(),
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		return err
+	}
+
+	return config
+}
+
+// IsRevoked checks if a certificate is listed in one of the loaded CRLs
+func (cm *CertificateManager) IsRevoked(cert *x509.Certificate) (time.Time, bool) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	revokedAt, ok := cm.revoked[revocationKey(cert.RawIssuer, cert.SerialNumber.String())]
+	return revokedAt, ok
+}
+
 // Close stops the file watcher and cleans up resources
 func (cm *CertificateManager) Close() error {
 	if cm.watcher != nil {
@@ -230,54 +464,219 @@ func (cm *CertificateManager) Close() error {
 	return nil
 }
 
-// loadConfig loads configuration from YAML file
-func loadConfig(configFile string) error {
-	if configFile == "" {
-		// No config file specified, use defaults (TLS disabled)
-		config = Config{
-			Server: ServerConfig{
-				Address: "",
-				Port:    "8080",
-			},
-			TLS: TLSConfig{
-				Enabled: false,
-			},
-		}
-		return nil
-	}
-
-	// Set defaults before loading config file
-	config = Config{
+// defaultConfig returns the configuration used without a config file and the
+// values a config file starts from
+func defaultConfig(tlsEnabled bool) *Config {
+	return &Config{
 		Server: ServerConfig{
-			Address: "",
-			Port:    "8080",
+			Address:           "",
+			Port:              "8080",
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      2 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   15 * time.Second,
 		},
 		TLS: TLSConfig{
-			Enabled: true,
+			Enabled: tlsEnabled,
 		},
+		Health: HealthConfig{
+			PollInterval: 15 * time.Second,
+			PollTimeout:  5 * time.Second,
+		},
+		History: HistoryConfig{
+			File:       "settings-history.jsonl",
+			MaxEntries: 1000,
+		},
+		Proxy: defaultProxyConfig(),
 	}
+}
+
+// loadConfig loads configuration from YAML file and validates it
+func loadConfig(configFile string) (*Config, error) {
+	if configFile == "" {
+		// No config file specified, use defaults (TLS disabled)
+		return defaultConfig(false), nil
+	}
+
+	// A config file enables TLS unless it says otherwise
+	cfg := defaultConfig(true)
 
 	data, err := os.ReadFile(configFile)
 	if err != nil {
-		return fmt.Errorf("failed to read config file %s: %v", configFile, err)
+		return nil, fmt.Errorf("failed to read config file %s: %v", configFile, err)
 	}
 
-	err = yaml.Unmarshal(data, &config)
+	err = yaml.Unmarshal(data, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to parse config file %s: %v", configFile, err)
+		return nil, fmt.Errorf("failed to parse config file %s: %v", configFile, err)
 	}
 
-	if debug {
-		log.Printf("Loaded config: Server address=%s, port=%s, TLS enabled=%v, CA file=%s, allowed CNs=%v",
-			config.Server.Address, config.Server.Port, config.TLS.Enabled, config.TLS.CAFile, config.TLS.AllowedCNs)
+	if err := validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", configFile, err)
+	}
+
+	slog.Debug("Loaded config", "file", configFile, "address", cfg.Server.Address, "port", cfg.Server.Port,
+		"tls", cfg.TLS.Enabled, "ca_file", cfg.TLS.CAFile, "allowed_cns", cfg.TLS.AllowedCNs)
+
+	return cfg, nil
+}
+
+// validateConfig checks the configuration for values the server cannot run with
+func validateConfig(cfg *Config) error {
+	port, err := strconv.Atoi(cfg.Server.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("server.port must be a number between 1 and 65535, got %q", cfg.Server.Port)
+	}
+
+	timeouts := map[string]time.Duration{
+		"server.read_timeout":        cfg.Server.ReadTimeout,
+		"server.read_header_timeout": cfg.Server.ReadHeaderTimeout,
+		"server.write_timeout":       cfg.Server.WriteTimeout,
+		"server.idle_timeout":        cfg.Server.IdleTimeout,
+		"server.shutdown_timeout":    cfg.Server.ShutdownTimeout,
+	}
+	for _, name := range slices.Sorted(maps.Keys(timeouts)) {
+		if timeouts[name] < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", name, timeouts[name])
+		}
+	}
+
+	if cfg.TLS.Enabled {
+		files := map[string]string{
+			"tls.ca_file":   cfg.TLS.CAFile,
+			"tls.cert_file": cfg.TLS.CertFile,
+			"tls.key_file":  cfg.TLS.KeyFile,
+		}
+		for _, name := range slices.Sorted(maps.Keys(files)) {
+			if files[name] == "" {
+				return fmt.Errorf("%s is required when TLS is enabled", name)
+			}
+			if _, err := os.Stat(files[name]); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		if err := validateExpiryWarningDays(&cfg.TLS); err != nil {
+			return err
+		}
+		if cfg.TLS.ReloadPollInterval <= 0 {
+			cfg.TLS.ReloadPollInterval = time.Minute
+		}
+		for i, pair := range cfg.TLS.Certificates {
+			for _, field := range []struct{ name, file string }{{"cert_file", pair.CertFile}, {"key_file", pair.KeyFile}} {
+				if field.file == "" {
+					return fmt.Errorf("tls.certificates[%d].%s is required", i, field.name)
+				}
+				if _, err := os.Stat(field.file); err != nil {
+					return fmt.Errorf("tls.certificates[%d].%s: %v", i, field.name, err)
+				}
+			}
+		}
+		for _, file := range cfg.TLS.CRLFiles {
+			if _, err := os.Stat(file); err != nil {
+				return fmt.Errorf("tls.crl_files: %v", err)
+			}
+		}
+	}
+
+	if err := validateProxyAuthConfig(&cfg.ProxyAuth); err != nil {
+		return err
+	}
+
+	// The allow-list and identity rules apply to client certificates and proxy identity headers
+	if cfg.TLS.Enabled || cfg.ProxyAuth.Enabled {
+		if err := compileIdentityRules(&cfg.TLS); err != nil {
+			return err
+		}
+		if len(cfg.TLS.AllowedCNs) == 0 && len(cfg.TLS.IdentityRules) == 0 && !cfg.TLS.AllowAnyValidCert {
+			slog.Warn("tls.allowed_cns and tls.identity_rules are empty and tls.allow_any_valid_cert is false, all clients will be rejected")
+		}
+	}
+
+	if err := validateOIDCConfig(&cfg.OIDC); err != nil {
+		return err
+	}
+
+	if cfg.Health.PollInterval <= 0 || cfg.Health.PollTimeout <= 0 {
+		return fmt.Errorf("health.poll_interval and health.poll_timeout must be positive")
+	}
+
+	if err := validateAllowedOrigins(cfg.Server.AllowedOrigins); err != nil {
+		return err
+	}
+
+	if err := validateBasePath(&cfg.Server); err != nil {
+		return err
+	}
+
+	if err := validateProxyConfig(cfg); err != nil {
+		return err
+	}
+
+	if cfg.History.MaxEntries < 0 {
+		return fmt.Errorf("history.max_entries must not be negative, got %d", cfg.History.MaxEntries)
 	}
 
 	return nil
 }
 
+// authMiddleware authenticates requests with an identity header from a trusted
+// proxy, a client certificate or, if OIDC is enabled, a login session
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := configManager.Get()
+		hasClientCert := r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+		oidcEnabled := config.OIDC.Enabled && oidcAuth != nil
+
+		// Identity headers are only honoured from trusted proxies
+		if config.ProxyAuth.Enabled {
+			header := config.ProxyAuth.Header
+			value, err := config.ProxyAuth.identityHeader(r)
+			if err != nil {
+				slog.Warn("Rejected request with a forged client identity header", "remote", r.RemoteAddr, "error", err)
+				http.Error(w, "Unexpected client identity header", http.StatusBadRequest)
+				return
+			}
+			if value != "" && config.ProxyAuth.Trusts(r) {
+				proxyHeaderAuth(next, header, value).ServeHTTP(w, r)
+				return
+			}
+			if value != "" {
+				slog.Warn("Ignoring client identity header from untrusted source", "header", header, "remote", r.RemoteAddr)
+			}
+		}
+
+		// A presented client certificate always decides, OIDC is the fallback without one
+		if config.TLS.Enabled && (hasClientCert || !oidcEnabled) {
+			clientCertAuthMiddleware(next).ServeHTTP(w, r)
+			return
+		}
+
+		if !oidcEnabled {
+			if config.ProxyAuth.Enabled {
+				http.Error(w, "Client identity required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, ok := oidcAuth.SessionIdentity(r)
+		if !ok {
+			oidcAuth.RequireLogin(w, r)
+			return
+		}
+
+		slog.Debug("Client authenticated with OIDC session", "user", identity.Name, "access", identity.Access)
+
+		next.ServeHTTP(w, withIdentity(r, identity))
+	})
+}
+
 // clientCertAuthMiddleware validates client certificates
 func clientCertAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := configManager.Get()
 		if !config.TLS.Enabled {
 			next.ServeHTTP(w, r)
 			return
@@ -291,39 +690,85 @@ func clientCertAuthMiddleware(next http.Handler) http.Handler {
 		clientCert := r.TLS.PeerCertificates[0]
 		clientCN := clientCert.Subject.CommonName
 
-		// Check if the CN is in the allowed list
-		allowed := false
-		for _, allowedCN := range config.TLS.AllowedCNs {
-			if clientCN == allowedCN {
-				allowed = true
-				break
-			}
+		if err := checkRevocation(r.TLS); err != nil {
+			slog.Warn("Rejected revoked client certificate",
+				"cn", clientCN, "serial", clientCert.SerialNumber.String(), "issuer", clientCert.Issuer.String(), "error", err)
+			http.Error(w, "Client certificate revoked", http.StatusForbidden)
+			return
 		}
 
+		// Check the certificate against the allowed CNs and identity rules
+		identity, allowed := matchClientCertificate(&config.TLS, clientCert)
 		if !allowed {
-			if debug {
-				log.Printf("Client certificate CN '%s' not in allowed list: %v", clientCN, config.TLS.AllowedCNs)
-			}
+			slog.Debug("Client certificate CN not in allowed list and matches no identity rule", "cn", clientCN, "allowed_cns", config.TLS.AllowedCNs)
 			http.Error(w, "Client certificate not authorized", http.StatusForbidden)
 			return
 		}
 
-		if debug {
-			log.Printf("Client authenticated with CN: %s", clientCN)
-		}
+		slog.Debug("Client authenticated", "cn", clientCN, "rules", identity.Rules)
+		expiryMonitor.CheckClient(clientCert)
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withIdentity(r, identity))
 	})
 }
 
+// checkRevocation checks the client certificate against the loaded CRLs and,
+// if enabled, its OCSP responder
+func checkRevocation(state *tls.ConnectionState) error {
+	clientCert := state.PeerCertificates[0]
+
+	if certManager != nil {
+		if revokedAt, ok := certManager.IsRevoked(clientCert); ok {
+			return fmt.Errorf("revoked at %s according to CRL", revokedAt.Format(time.RFC3339))
+		}
+	}
+
+	if ocspChecker != nil {
+		// The issuer is taken from the chain verified during the TLS handshake
+		if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) < 2 {
+			return fmt.Errorf("no verified issuer for OCSP check")
+		}
+		if err := ocspChecker.Check(clientCert, state.VerifiedChains[0][1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clientIdentity returns the name of the authenticated client, or "anonymous" without one
+func clientIdentity(r *http.Request) string {
+	if id, ok := identityFromContext(r.Context()); ok {
+		return id.Name
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return "anonymous"
+}
+
 func main() {
 
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "gen-certs" {
+		if err := genCertsCommand(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate certificates: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
 		versionFlag = flag.Bool("version", false, "show build time and version number")
 		configFile  = flag.String("config", "", "path to YAML configuration file")
 	)
-	flag.BoolVar(&debug, "debug", false, "log debug output, defaults to false")
-	flag.BoolVar(&verbose, "verbose", false, "log verbose output, defaults to false")
+	var (
+		logFormat = flag.String("log-format", "text", "log output format, text or json")
+		logLevel  = flag.String("log-level", "info", "minimum log level, debug, info, warn or error")
+		debug     = flag.Bool("debug", false, "log debug output, same as -log-level debug")
+		verbose   = flag.Bool("verbose", false, "log verbose output, same as -log-level debug")
+	)
+	flag.BoolVar(&accessLogEnabled, "access-log", true, "log every request with client identity and upstream status")
 	flag.Parse()
 
 	version := *versionFlag
@@ -333,29 +778,88 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Load configuration
-	err := loadConfig(*configFile)
+	if *debug || *verbose {
+		*logLevel = "debug"
+	}
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// The lifecycle shuts down the server and all background tasks on SIGINT/SIGTERM
+	lifecycle := NewLifecycle()
+
+	// Load configuration and watch it for changes
+	var err error
+	configManager, err = NewConfigManager(*configFile)
+	if err != nil {
+		fatal("Failed to load configuration", "error", err)
+	}
+	config := configManager.Get()
+	basePath = config.Server.BasePath
+	lifecycle.Go("config watcher", configManager.watchForChanges)
+	lifecycle.OnShutdown("Config manager", configManager.Close)
+
+	// Load the cluster settings change history
+	settingsHistory, err = NewSettingsHistory(config.History.File, config.History.MaxEntries)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to initialize settings history", "error", err)
 	}
 
-	// Wrap handlers with client cert auth middleware
-	authMiddleware := clientCertAuthMiddleware
+	// Set up OpenID Connect single sign-on
+	if config.OIDC.Enabled {
+		oidcAuth = NewOIDCAuthenticator(config.OIDC)
+		http.HandleFunc("/auth/login", oidcAuth.LoginHandler)
+		http.HandleFunc("/auth/callback", oidcAuth.CallbackHandler)
+		http.HandleFunc("/auth/logout", oidcAuth.LogoutHandler)
+		slog.Info("OIDC single sign-on enabled", "issuer", config.OIDC.IssuerURL)
+	}
 
-	// Register the handler for the root URL to serve the main HTML page
-	http.Handle("/", authMiddleware(http.HandlerFunc(dashboardHandler)))
+	if config.ProxyAuth.Enabled {
+		slog.Info("Accepting client identity headers from trusted proxies", "header", config.ProxyAuth.Header, "trusted_proxies", config.ProxyAuth.TrustedProxies)
+	}
 
-	// Create a file server from the embedded filesystem.
-	fileServer := http.FileServer(http.FS(staticDir))
+	// Register the unauthenticated health and readiness endpoints
+	if err := registerHealthHandlers(config, lifecycle); err != nil {
+		fatal("Failed to set up health endpoints", "error", err)
+	}
 
-	// Register the file server to handle all requests that start with "/static/"
-	http.Handle("/static/", authMiddleware(fileServer))
+	// Precompress the embedded static files and point the dashboard at their current versions
+	staticAssets, err = loadStaticAssets(staticDir, "static")
+	if err != nil {
+		fatal("Failed to load static files", "error", err)
+	}
+	dashboardTemplate, err = loadDashboardTemplate(templatesDir, staticAssets)
+	if err != nil {
+		fatal("Failed to load dashboard template", "error", err)
+	}
+
+	// Register the handler for the root URL to serve the main HTML page
+	http.Handle("/", authMiddleware(compressMiddleware(http.HandlerFunc(dashboardHandler))))
+
+	// Register the precompressed static files for all requests that start with "/static/"
+	http.Handle("/static/", authMiddleware(staticAssets))
 
 	// Register the favicon handler
 	http.Handle("/favicon.ico", authMiddleware(http.HandlerFunc(faviconHandler)))
 
 	// Register the proxy handler for Elasticsearch requests
-	http.Handle("/proxy", authMiddleware(http.HandlerFunc(proxyHandler)))
+	http.Handle("/proxy", authMiddleware(rateLimitMiddleware(compressMiddleware(http.HandlerFunc(proxyHandler)))))
+
+	// Register the cluster settings change history handler
+	http.Handle("/api/settings/history", authMiddleware(http.HandlerFunc(settingsHistoryHandler)))
+
+	// Register the handler serving the catalog of known cluster settings
+	http.Handle("/api/settings/catalog", authMiddleware(http.HandlerFunc(settingsCatalogHandler)))
+
+	// Register the dry-run preview handler for cluster settings changes
+	http.Handle("/api/settings/preview", authMiddleware(rateLimitMiddleware(http.HandlerFunc(settingsPreviewHandler))))
+
+	// Register the handler returning the days to expiry of the certificates
+	http.Handle("/api/certificates", authMiddleware(http.HandlerFunc(certificatesHandler)))
+
+	// Register the handler returning the identity of the logged-in user
+	http.Handle("/api/whoami", authMiddleware(http.HandlerFunc(whoamiHandler)))
 
 	// Get server address and port from config
 	address := config.Server.Address
@@ -372,151 +876,230 @@ func main() {
 	if config.TLS.Enabled {
 		protocol = "https"
 	}
-	fmt.Printf("go-elastic-board server version %s with build time %s starting on %s://%s\n", buildversion, buildtime, protocol, listenAddr)
-	fmt.Println("All static assets are embedded. You can now run this binary by itself.")
+	slog.Info("go-elastic-board server starting, all static assets are embedded", "version", buildversion, "build_time", buildtime, "url", protocol+"://"+listenAddr+withBasePath("/"))
 
+	var tlsConfig *tls.Config
 	if config.TLS.Enabled {
-		fmt.Printf("TLS client certificate authentication enabled with CA: %s\n", config.TLS.CAFile)
-		fmt.Printf("Allowed client certificate CNs: %v\n", config.TLS.AllowedCNs)
+		slog.Info("TLS client certificate authentication enabled", "ca_file", config.TLS.CAFile, "allowed_cns", config.TLS.AllowedCNs,
+			"identity_rules", len(config.TLS.IdentityRules), "allow_any_valid_cert", config.TLS.AllowAnyValidCert)
 
 		// Initialize certificate manager with file watching
-		var err error
-		certManager, err = NewCertificateManager(config.TLS.CertFile, config.TLS.KeyFile, config.TLS.CAFile)
+		certManager, err = NewCertificateManager(config.TLS)
 		if err != nil {
-			log.Fatalf("Failed to initialize certificate manager: %v", err)
+			fatal("Failed to initialize certificate manager", "error", err)
 		}
-
-		// Configure TLS with certificate manager
-		tlsConfig := &tls.Config{
-			ClientAuth:     tls.RequireAndVerifyClientCert,
-			ClientCAs:      certManager.GetCACertPool(),
-			GetCertificate: certManager.GetCertificate,
-			// Enable automatic certificate reloading
-			GetClientCertificate: nil,
+		if len(config.TLS.Certificates) > 0 {
+			slog.Info("Additional server certificates selected by SNI", "count", len(config.TLS.Certificates))
 		}
+		lifecycle.Go("certificate watcher", certManager.watchForChanges)
+		lifecycle.OnShutdown("Certificate manager", certManager.Close)
+		lifecycle.Go("certificate expiry monitor", expiryMonitor.Run)
 
-		server := &http.Server{
-			Addr:      listenAddr,
-			TLSConfig: tlsConfig,
+		if config.TLS.OCSP.Enabled {
+			ocspChecker = NewOCSPChecker(config.TLS.OCSP)
+			slog.Info("OCSP checking of client certificates enabled")
 		}
 
-		fmt.Printf("Certificate monitoring enabled - certificates will be automatically reloaded on file changes\n")
-
-		// Set up graceful shutdown
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		// Handle shutdown signals
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-		// Start server in a goroutine
-		serverErr := make(chan error, 1)
-		go func() {
-			// Use ListenAndServeTLS for TLS-enabled server
-			serverErr <- server.ListenAndServeTLS("", "")
-		}()
-
-		// Wait for shutdown signal or server error
-		select {
-		case err := <-serverErr:
-			if err != nil && err != http.ErrServerClosed {
-				log.Fatalf("Server error: %v", err)
-			}
-		case sig := <-sigChan:
-			log.Printf("Received signal %s, shutting down gracefully...", sig)
-
-			// Shutdown server with timeout
-			shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 5*time.Second)
-			defer shutdownCancel()
+		// Client certificates become optional when OIDC login is available as well
+		clientAuth := tls.RequireAndVerifyClientCert
+		if config.OIDC.Enabled {
+			clientAuth = tls.VerifyClientCertIfGiven
+		}
 
-			if err := server.Shutdown(shutdownCtx); err != nil {
-				log.Printf("Server shutdown error: %v", err)
-			}
+		// Configure TLS with certificate manager, reloaded certificates and CAs apply to new handshakes
+		tlsConfig = certManager.TLSConfig(clientAuth)
 
-			// Clean up certificate manager
-			if err := certManager.Close(); err != nil {
-				log.Printf("Certificate manager cleanup error: %v", err)
-			} else {
-				log.Printf("Certificate manager stopped")
-			}
-		}
-	} else {
-		// Start HTTP server without TLS
-		log.Fatal(http.ListenAndServe(listenAddr, nil))
+		slog.Info("Certificate monitoring enabled, certificates are reloaded on file changes")
 	}
 
+	// Serve HTTP or HTTPS until SIGINT/SIGTERM, then drain in-flight requests
+	server := newHTTPServer(config, listenAddr, tlsConfig)
+	if err := lifecycle.Run(server, config.Server.ShutdownTimeout); err != nil {
+		fatal("Server error", "error", err)
+	}
 }
 
 // Favicon handler to serve favicon.ico from the embedded static folder
 func faviconHandler(w http.ResponseWriter, r *http.Request) {
-	// Open the favicon file from the embedded static directory
-	file, err := staticDir.Open("static/favicon.ico")
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-	defer file.Close()
-
-	// Set the content type for favicon
-	w.Header().Set("Content-Type", "image/x-icon")
-
-	// Copy the file content to the response
-	io.Copy(w, file)
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/static/favicon.ico"
+	staticAssets.ServeHTTP(w, r2)
 }
 
 // Proxy handler to forward requests to Elasticsearch
 func proxyHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		writeProxyError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST method is allowed")
 		return
 	}
 
+	config := configManager.Get()
+	proxyConfig := config.Proxy
+	r.Body = http.MaxBytesReader(w, r.Body, proxyConfig.MaxRequestBytes)
+
 	var reqBody struct {
 		Path   string `json:"path"`
 		Method string `json:"method,omitempty"`
 		Body   string `json:"body,omitempty"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeStrictJSON(r, &reqBody); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.Is(err, errUnsupportedMediaType) {
+			writeProxyError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", err.Error())
+			return
+		}
+		if errors.As(err, &tooLarge) {
+			writeProxyError(w, http.StatusRequestEntityTooLarge, "request_too_large",
+				fmt.Sprintf("Request exceeds proxy.max_request_bytes of %d bytes", tooLarge.Limit))
+			return
+		}
+		writeProxyError(w, http.StatusBadRequest, "invalid_request", "Invalid request body: "+err.Error())
+		return
+	}
+	if int64(len(reqBody.Body)) > proxyConfig.MaxBodyBytes {
+		writeProxyError(w, http.StatusRequestEntityTooLarge, "body_too_large",
+			fmt.Sprintf("Body exceeds proxy.max_body_bytes of %d bytes", proxyConfig.MaxBodyBytes))
 		return
 	}
 
 	// Default to GET if no method specified
-	method := reqBody.Method
+	method := strings.ToUpper(reqBody.Method)
 	if method == "" {
 		method = http.MethodGet
 	}
+	if !slices.Contains(proxiedMethods, method) {
+		writeProxyError(w, http.StatusBadRequest, "invalid_request",
+			fmt.Sprintf("Unsupported method %q, use one of %s", reqBody.Method, strings.Join(proxiedMethods, ", ")))
+		return
+	}
+	if reqBody.Path == "" {
+		writeProxyError(w, http.StatusBadRequest, "invalid_request", "Missing path")
+		return
+	}
 
-	esURL := "http://localhost:9200" + reqBody.Path
+	// Requests that may change data must not be forged by other sites
+	if isMutatingMethod(method) {
+		if err := checkCSRF(r, config.Server.AllowedOrigins); err != nil {
+			slog.Warn("Rejected possible cross-site request", "method", method, "es_path", reqBody.Path,
+				"user", clientIdentity(r), "remote", r.RemoteAddr, "error", err)
+			writeProxyError(w, http.StatusForbidden, "csrf_rejected", "Request rejected: "+err.Error())
+			return
+		}
+	}
+
+	// Read-only identities, and any without a known access level, may only
+	// query Elasticsearch
+	if id, ok := identityFromContext(r.Context()); ok && id.Access != accessAdmin &&
+		method != http.MethodGet && method != http.MethodHead {
+		slog.Warn("Rejected request from read-only user", "method", method, "es_path", reqBody.Path, "user", id.Name)
+		writeProxyError(w, http.StatusForbidden, "read_only", "Read-only access, only GET requests are allowed")
+		return
+	}
+
+	esURL, esPath, err := upstreamURL(reqBody.Path)
+	if err != nil {
+		slog.Warn("Rejected invalid Elasticsearch path", "es_path", reqBody.Path,
+			"user", clientIdentity(r), "remote", r.RemoteAddr, "error", err)
+		writeProxyError(w, http.StatusBadRequest, "invalid_path", "Invalid path: "+err.Error())
+		return
+	}
+
+	// The deadline covers the whole exchange with Elasticsearch, and a closed
+	// browser tab cancels it
+	timeout := proxyConfig.TimeoutFor(esPath)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	entry := accessLogFromContext(r.Context())
+	if entry != nil {
+		entry.ESMethod = method
+		entry.ESPath = reqBody.Path
+	}
+
+	// Identical GETs from many open dashboards share one upstream request
+	if method == http.MethodGet && reqBody.Body == "" {
+		proxyCache.ServeGET(w, r, reqBody.Path, esURL, timeout)
+		return
+	}
+
+	// Validate cluster settings changes against the catalog and remember their
+	// previous values for the settings history
+	var settingsChanges []SettingsChange
+	if isClusterSettingsUpdate(method, esPath) {
+		changes, err := parseSettingsUpdate(reqBody.Body)
+		if err != nil {
+			writeProxyError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if errs := validateSettingsChanges(changes); len(errs) > 0 {
+			slog.Debug("Rejected invalid cluster settings change", "errors", errs)
+			writeSettingsValidationErrors(w, errs)
+			return
+		}
+		if settingsHistory != nil {
+			current, err := fetchClusterSettings(ctx, false)
+			if err != nil {
+				writeUpstreamError(w, r, err, timeout)
+				return
+			}
+			fillSettingsBefore(changes, current)
+			user := clientIdentity(r)
+			for i := range changes {
+				changes[i].User = user
+			}
+			settingsChanges = changes
+		}
+	}
 
 	var esReq *http.Request
-	var err error
 
 	// Create request with body if provided
 	if reqBody.Body != "" {
-		esReq, err = http.NewRequest(method, esURL, strings.NewReader(reqBody.Body))
+		esReq, err = http.NewRequestWithContext(ctx, method, esURL, strings.NewReader(reqBody.Body))
 		if err != nil {
-			http.Error(w, "Failed to create request: "+err.Error(), http.StatusInternalServerError)
+			writeProxyError(w, http.StatusBadRequest, "invalid_request", "Failed to create request: "+err.Error())
 			return
 		}
 		esReq.Header.Set("Content-Type", "application/json")
 	} else {
-		esReq, err = http.NewRequest(method, esURL, nil)
+		esReq, err = http.NewRequestWithContext(ctx, method, esURL, nil)
 		if err != nil {
-			http.Error(w, "Failed to create request: "+err.Error(), http.StatusInternalServerError)
+			writeProxyError(w, http.StatusBadRequest, "invalid_request", "Failed to create request: "+err.Error())
 			return
 		}
 	}
 
+	upstreamStart := time.Now()
 	esRes, err := http.DefaultClient.Do(esReq)
+	if entry != nil {
+		entry.UpstreamLatency = time.Since(upstreamStart)
+		if err == nil {
+			entry.UpstreamStatus = esRes.StatusCode
+		}
+	}
 	if err != nil {
-		http.Error(w, "Failed to fetch from Elasticsearch: "+err.Error(), http.StatusServiceUnavailable)
+		writeUpstreamError(w, r, err, timeout)
 		return
 	}
 	defer esRes.Body.Close()
 
+	// Writes make cached responses stale
+	if method != http.MethodGet && method != http.MethodHead {
+		proxyCache.Invalidate()
+	}
+
+	if len(settingsChanges) > 0 && esRes.StatusCode >= 200 && esRes.StatusCode < 300 {
+		if err := settingsHistory.Record(settingsChanges); err != nil {
+			slog.Error("Failed to record cluster settings change", "error", err)
+		}
+		for _, change := range settingsChanges {
+			slog.Info("Cluster setting changed", "scope", change.Scope, "key", change.Key, "user", change.User, "before", change.Before, "after", change.After)
+		}
+	}
+
 	maps.Copy(w.Header(), esRes.Header)
 	w.WriteHeader(esRes.StatusCode)
-	io.Copy(w, esRes.Body)
+	if _, err := io.Copy(w, esRes.Body); err != nil && ctx.Err() == context.DeadlineExceeded {
+		slog.Warn("Elasticsearch response cut off by the proxy timeout", "es_path", reqBody.Path, "timeout", timeout)
+	}
 }
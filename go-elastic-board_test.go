@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCA creates a CA certificate for tests
+func newTestCA(t *testing.T, name string) *generatedCert {
+	t.Helper()
+	ca, err := generateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+// newTestLeaf creates a server or client certificate signed by ca for tests
+func newTestLeaf(t *testing.T, ca *generatedCert, name string, usage x509.ExtKeyUsage) *generatedCert {
+	t.Helper()
+	leaf, err := generateCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}, time.Hour, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+// tlsCertificate converts a generated certificate for use in a tls.Config
+func (gc *generatedCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{gc.cert.Raw}, PrivateKey: gc.key, Leaf: gc.cert}
+}
+
+func TestTLSConfigCARotation(t *testing.T) {
+	dir := t.TempDir()
+	oldCA := newTestCA(t, "old CA")
+	newCA := newTestCA(t, "new CA")
+	server := newTestLeaf(t, oldCA, "localhost", x509.ExtKeyUsageServerAuth)
+	for name, gc := range map[string]*generatedCert{"ca": oldCA, "new-ca": newCA, "server": server} {
+		if err := writeCertificate(dir, name, gc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cm, err := NewCertificateManager(TLSConfig{
+		CertFile:           filepath.Join(dir, "server.crt"),
+		KeyFile:            filepath.Join(dir, "server.key"),
+		CAFile:             filepath.Join(dir, "ca.crt"),
+		ReloadPollInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = cm.TLSConfig(tls.RequireAndVerifyClientCert)
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverRoots := x509.NewCertPool()
+	serverRoots.AddCert(oldCA.cert)
+
+	// newClient returns an HTTP client that opens a new connection for every
+	// request and resumes the TLS session of the previous one. It sends its
+	// certificate even if the server does not list the CA as acceptable.
+	newClient := func(cert *generatedCert) *http.Client {
+		tlsCert := cert.tlsCertificate()
+		return &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				RootCAs: serverRoots,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &tlsCert, nil
+				},
+				ClientSessionCache: tls.NewLRUClientSessionCache(1),
+			},
+		}}
+	}
+
+	// get returns whether the request was accepted and the session resumed
+	get := func(client *http.Client) (accepted, resumed bool) {
+		t.Helper()
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			return false, false
+		}
+		defer res.Body.Close()
+		return res.StatusCode == http.StatusOK, res.TLS.DidResume
+	}
+
+	oldClientCert := newTestLeaf(t, oldCA, "old-client", x509.ExtKeyUsageClientAuth)
+	oldClient := newClient(oldClientCert)
+	newClientCert := newTestLeaf(t, newCA, "new-client", x509.ExtKeyUsageClientAuth)
+
+	if accepted, _ := get(oldClient); !accepted {
+		t.Fatal("client certificate of the old CA rejected before the rotation")
+	}
+	if accepted, resumed := get(oldClient); !accepted || !resumed {
+		t.Fatalf("resumed session before the rotation: accepted %v, resumed %v", accepted, resumed)
+	}
+	if accepted, _ := get(newClient(newClientCert)); accepted {
+		t.Fatal("client certificate of the new CA accepted before the rotation")
+	}
+
+	// Rotate the CA, as an update of the mounted file would
+	caPEM, err := os.ReadFile(filepath.Join(dir, "new-ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), caPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cm.reload()
+
+	// The old client still holds a session ticket from before the rotation
+	if accepted, _ := get(oldClient); accepted {
+		t.Fatal("resumed session of the old CA accepted after the rotation")
+	}
+	if accepted, _ := get(newClient(newTestLeaf(t, oldCA, "other-old-client", x509.ExtKeyUsageClientAuth))); accepted {
+		t.Fatal("client certificate of the old CA accepted after the rotation")
+	}
+
+	client := newClient(newClientCert)
+	if accepted, _ := get(client); !accepted {
+		t.Fatal("client certificate of the new CA rejected after the rotation")
+	}
+	if accepted, resumed := get(client); !accepted || !resumed {
+		t.Fatalf("resumed session after the rotation: accepted %v, resumed %v", accepted, resumed)
+	}
+
+	// The standard library may already refuse to resume a session whose CA
+	// pool changed, check the VerifyConnection fallback on its own as well
+	verify := cm.TLSConfig(tls.RequireAndVerifyClientCert).VerifyConnection
+	if err := verify(tls.ConnectionState{DidResume: true, PeerCertificates: []*x509.Certificate{oldClientCert.cert}}); err == nil {
+		t.Error("VerifyConnection accepted a resumed session of the old CA")
+	}
+	if err := verify(tls.ConnectionState{DidResume: true, PeerCertificates: []*x509.Certificate{newClientCert.cert}}); err != nil {
+		t.Errorf("VerifyConnection rejected a resumed session of the new CA: %v", err)
+	}
+}
+
+func TestGetCertificateSNI(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test CA")
+	for name, dnsNames := range map[string][]string{
+		"default":  {"*.example.com"},
+		"internal": {"internal.example.com"},
+		"other":    {"board.other.test"},
+	} {
+		cert, err := generateCertificate(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			DNSNames:    dnsNames,
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, time.Hour, ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeCertificate(dir, name, cert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeCertificate(dir, "ca", ca); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := NewCertificateManager(TLSConfig{
+		CertFile: filepath.Join(dir, "default.crt"),
+		KeyFile:  filepath.Join(dir, "default.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+		Certificates: []CertificatePair{
+			{CertFile: filepath.Join(dir, "internal.crt"), KeyFile: filepath.Join(dir, "internal.key")},
+			{CertFile: filepath.Join(dir, "other.crt"), KeyFile: filepath.Join(dir, "other.key")},
+		},
+		ReloadPollInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"internal.example.com", "internal"},
+		{"board.other.test", "other"},
+		{"www.example.com", "default"},
+		{"unknown.test", "default"},
+		{"", "default"},
+	}
+
+	for _, tt := range tests {
+		cert, err := cm.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cert.Leaf.Subject.CommonName; got != tt.want {
+			t.Errorf("GetCertificate(%q) = %s, want %s", tt.serverName, got, tt.want)
+		}
+	}
+}
@@ -3,8 +3,16 @@ module github.com/xorpaul/go-elastic-board
 go 1.24.6
 
 require (
+	github.com/andybalholm/brotli v1.2.6
+	github.com/coreos/go-oidc/v3 v3.15.0
 	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/crypto v0.43.0
+	golang.org/x/oauth2 v0.30.0
 	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
-require golang.org/x/sys v0.36.0 // indirect
+require (
+	github.com/go-jose/go-jose/v4 v4.0.5 // indirect
+	golang.org/x/sys v0.37.0 // indirect
+)
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status values of health checks
+const (
+	checkOK       = "ok"
+	checkFailed   = "fail"
+	checkDisabled = "disabled"
+)
+
+// HealthConfig holds the configuration of the health and readiness endpoints
+type HealthConfig struct {
+	// Address serves the endpoints on a separate listener, e.g. ":8081".
+	// If empty, they are served by the main server.
+	Address      string        `yaml:"address"`
+	RequireAuth  bool          `yaml:"require_auth"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	PollTimeout  time.Duration `yaml:"poll_timeout"`
+}
+
+// HealthCheck is the result of a single readiness check
+type HealthCheck struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// ReadinessReport is the response of /readyz
+type ReadinessReport struct {
+	Status             string                 `json:"status"`
+	LastSuccessfulPoll *time.Time             `json:"last_successful_poll"`
+	Checks             map[string]HealthCheck `json:"checks"`
+}
+
+// ElasticsearchPoller periodically checks that Elasticsearch is reachable
+type ElasticsearchPoller struct {
+	interval    time.Duration
+	client      *http.Client
+	mutex       sync.RWMutex
+	lastSuccess time.Time
+	lastStatus  string
+	lastError   error
+}
+
+var esPoller *ElasticsearchPoller
+
+// NewElasticsearchPoller creates a poller for the cluster health endpoint
+func NewElasticsearchPoller(config HealthConfig) *ElasticsearchPoller {
+	return &ElasticsearchPoller{
+		interval: config.PollInterval,
+		client:   &http.Client{Timeout: config.PollTimeout},
+	}
+}
+
+// Run polls Elasticsearch until ctx is cancelled
+func (p *ElasticsearchPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll requests the cluster health and records the result
+func (p *ElasticsearchPoller) poll(ctx context.Context) {
+	status, err := p.clusterHealth(ctx)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err != nil {
+		if p.lastError == nil {
+			slog.Warn("Elasticsearch is not reachable", "url", elasticsearchURL, "error", err)
+		}
+		p.lastError = err
+		return
+	}
+	if p.lastError != nil {
+		slog.Info("Elasticsearch is reachable again", "url", elasticsearchURL)
+	}
+	p.lastError = nil
+	p.lastStatus = status
+	p.lastSuccess = time.Now()
+}
+
+// clusterHealth returns the cluster health status (green, yellow or red)
+func (p *ElasticsearchPoller) clusterHealth(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, elasticsearchURL+"/_cluster/health", nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cluster health returned HTTP %d", res.StatusCode)
+	}
+
+	var health struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return "", fmt.Errorf("failed to parse cluster health: %v", err)
+	}
+	return health.Status, nil
+}
+
+// Check reports whether the last poll succeeded recently enough
+func (p *ElasticsearchPoller) Check() (HealthCheck, time.Time) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	check := HealthCheck{Status: checkOK, Details: map[string]any{"url": elasticsearchURL}}
+	switch {
+	case p.lastError != nil:
+		check.Status = checkFailed
+		check.Message = p.lastError.Error()
+	case p.lastSuccess.IsZero():
+		check.Status = checkFailed
+		check.Message = "Elasticsearch has not been polled yet"
+	case time.Since(p.lastSuccess) > 3*p.interval:
+		check.Status = checkFailed
+		check.Message = fmt.Sprintf("last successful poll is older than %s", 3*p.interval)
+	default:
+		check.Details["cluster_status"] = p.lastStatus
+	}
+	return check, p.lastSuccess
+}
+
+// certificateCheck reports whether the server and CA certificates are loaded and valid
+func certificateCheck() HealthCheck {
+	if !configManager.Get().TLS.Enabled || certManager == nil {
+		return HealthCheck{Status: checkDisabled, Message: "TLS is disabled"}
+	}
+
+	serverCerts, caCerts := certManager.GetCertificates()
+	if len(serverCerts) == 0 {
+		return HealthCheck{Status: checkFailed, Message: "no server certificate loaded"}
+	}
+
+	now := time.Now()
+	check := HealthCheck{Status: checkOK, Details: map[string]any{
+		"expiry": certificateExpiries(nil),
+	}}
+	for _, serverCert := range serverCerts {
+		if (now.Before(serverCert.NotBefore) || now.After(serverCert.NotAfter)) && check.Status == checkOK {
+			check.Status = checkFailed
+			check.Message = fmt.Sprintf("server certificate %s is not valid now (valid %s to %s)",
+				serverCert.Subject.CommonName, serverCert.NotBefore.Format(time.RFC3339), serverCert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	for _, ca := range caCerts {
+		if now.After(ca.NotAfter) && check.Status == checkOK {
+			check.Status = checkFailed
+			check.Message = fmt.Sprintf("CA certificate %s expired at %s", ca.Subject.CommonName, ca.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return check
+}
+
+// healthzHandler reports that the process is alive
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": checkOK})
+}
+
+// readyzHandler reports whether the board can serve requests
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := ReadinessReport{
+		Status: checkOK,
+		Checks: map[string]HealthCheck{"certificates": certificateCheck()},
+	}
+
+	esCheck, lastSuccess := esPoller.Check()
+	report.Checks["elasticsearch"] = esCheck
+	if !lastSuccess.IsZero() {
+		report.LastSuccessfulPoll = &lastSuccess
+	}
+
+	for _, check := range report.Checks {
+		if check.Status == checkFailed {
+			report.Status = checkFailed
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != checkOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// registerHealthHandlers serves /healthz, /readyz and /metrics on the main server or,
+// if health.address is set, on a separate listener managed by the lifecycle.
+// /metrics always requires authentication on the main server.
+func registerHealthHandlers(config *Config, lifecycle *Lifecycle) error {
+	esPoller = NewElasticsearchPoller(config.Health)
+	lifecycle.Go("Elasticsearch poller", esPoller.Run)
+
+	wrap := func(h http.HandlerFunc) http.Handler {
+		if config.Health.RequireAuth {
+			return authMiddleware(h)
+		}
+		return h
+	}
+
+	if config.Health.Address == "" {
+		http.Handle("/healthz", wrap(healthzHandler))
+		http.Handle("/readyz", wrap(readyzHandler))
+		// The metrics name the identities of the users, everyone who can
+		// reach the main server must not see them
+		http.Handle("/metrics", authMiddleware(http.HandlerFunc(metricsHandler)))
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", wrap(healthzHandler))
+	mux.Handle("/readyz", wrap(readyzHandler))
+	mux.Handle("/metrics", wrap(metricsHandler))
+
+	listener, err := net.Listen("tcp", config.Health.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on health.address %s: %v", config.Health.Address, err)
+	}
+	server := &http.Server{
+		Handler:           accessLogMiddleware(securityHeadersMiddleware(mux)),
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+	}
+
+	lifecycle.Go("health server", func(ctx context.Context) {
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Health server error", "error", err)
+		}
+	})
+
+	slog.Info("Health endpoints listening", "address", config.Health.Address, "paths", []string{"/healthz", "/readyz", "/metrics"})
+	return nil
+}
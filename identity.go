@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// IdentityRule matches client certificates by subject, SAN or fingerprint.
+// All fields set in a rule must match; a certificate is allowed if any rule matches.
+// Glob patterns support * and ? wildcards.
+type IdentityRule struct {
+	Name               string `yaml:"name"`
+	CN                 string `yaml:"cn"`
+	CNRegex            string `yaml:"cn_regex"`
+	Organization       string `yaml:"organization"`
+	OrganizationalUnit string `yaml:"organizational_unit"`
+	SANEmail           string `yaml:"san_email"`
+	SANDNS             string `yaml:"san_dns"`
+	SANURI             string `yaml:"san_uri"`
+	FingerprintSHA256  string `yaml:"fingerprint_sha256"`
+
+	matchers []func(*x509.Certificate) bool
+}
+
+// Identity describes an authenticated client
+type Identity struct {
+	Name   string   `json:"name"`
+	Source string   `json:"source"`
+	Rules  []string `json:"rules,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Access string   `json:"access"`
+}
+
+type identityContextKey struct{}
+
+// withIdentity returns a copy of the request carrying the authenticated identity
+// and records the identity for the access log
+func withIdentity(r *http.Request, id Identity) *http.Request {
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.User = id.Name
+	}
+	return r.WithContext(context.WithValue(r.Context(), identityContextKey{}, id))
+}
+
+// identityFromContext returns the identity stored by the authentication middleware
+func identityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(Identity)
+	return id, ok
+}
+
+// whoamiHandler returns the identity of the authenticated client
+func whoamiHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := identityFromContext(r.Context())
+	if !ok {
+		id = Identity{Name: clientIdentity(r), Source: "none", Access: accessAdmin}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(id)
+}
+
+// compile validates the rule and prepares its matchers
+func (rule *IdentityRule) compile() error {
+	rule.matchers = nil
+
+	globs := []struct {
+		field   string
+		pattern string
+		values  func(*x509.Certificate) []string
+	}{
+		{"cn", rule.CN, func(c *x509.Certificate) []string { return []string{c.Subject.CommonName} }},
+		{"organization", rule.Organization, func(c *x509.Certificate) []string { return c.Subject.Organization }},
+		{"organizational_unit", rule.OrganizationalUnit, func(c *x509.Certificate) []string { return c.Subject.OrganizationalUnit }},
+		{"san_email", rule.SANEmail, func(c *x509.Certificate) []string { return c.EmailAddresses }},
+		{"san_dns", rule.SANDNS, func(c *x509.Certificate) []string { return c.DNSNames }},
+		{"san_uri", rule.SANURI, func(c *x509.Certificate) []string {
+			uris := make([]string, len(c.URIs))
+			for i, u := range c.URIs {
+				uris[i] = u.String()
+			}
+			return uris
+		}},
+	}
+	for _, g := range globs {
+		if g.pattern == "" {
+			continue
+		}
+		re, err := globToRegexp(g.pattern)
+		if err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %v", g.field, g.pattern, err)
+		}
+		values := g.values
+		rule.matchers = append(rule.matchers, func(c *x509.Certificate) bool {
+			return slices.ContainsFunc(values(c), re.MatchString)
+		})
+	}
+
+	// cn_regex must match the whole CN, like the glob patterns
+	if rule.CNRegex != "" {
+		re, err := regexp.Compile(`^(?:` + rule.CNRegex + `)$`)
+		if err != nil {
+			return fmt.Errorf("invalid cn_regex %q: %v", rule.CNRegex, err)
+		}
+		rule.matchers = append(rule.matchers, func(c *x509.Certificate) bool {
+			return re.MatchString(c.Subject.CommonName)
+		})
+	}
+
+	if rule.FingerprintSHA256 != "" {
+		fingerprint := normalizeFingerprint(rule.FingerprintSHA256)
+		if _, err := hex.DecodeString(fingerprint); err != nil || len(fingerprint) != sha256.Size*2 {
+			return fmt.Errorf("invalid fingerprint_sha256 %q: expected %d hex digits", rule.FingerprintSHA256, sha256.Size*2)
+		}
+		rule.matchers = append(rule.matchers, func(c *x509.Certificate) bool {
+			return certificateFingerprint(c) == fingerprint
+		})
+	}
+
+	if len(rule.matchers) == 0 {
+		return fmt.Errorf("rule has no match criteria")
+	}
+	return nil
+}
+
+// Matches checks if the certificate satisfies every criterion of the rule
+func (rule *IdentityRule) Matches(cert *x509.Certificate) bool {
+	if len(rule.matchers) == 0 {
+		return false
+	}
+	for _, match := range rule.matchers {
+		if !match(cert) {
+			return false
+		}
+	}
+	return true
+}
+
+// label returns the rule name, or a generated one for unnamed rules
+func (rule *IdentityRule) label(index int) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("rule-%d", index+1)
+}
+
+// compileIdentityRules validates and prepares all identity rules of the TLS config
+func compileIdentityRules(tlsConfig *TLSConfig) error {
+	for i := range tlsConfig.IdentityRules {
+		if err := tlsConfig.IdentityRules[i].compile(); err != nil {
+			return fmt.Errorf("tls.identity_rules[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// matchClientCertificate checks a verified client certificate against the
+// allow-list, identity rules and allow_any_valid_cert mode
+func matchClientCertificate(tlsConfig *TLSConfig, cert *x509.Certificate) (Identity, bool) {
+	id := Identity{
+		Name:   cert.Subject.CommonName,
+		Source: "client-certificate",
+		Access: accessAdmin,
+	}
+
+	if slices.Contains(tlsConfig.AllowedCNs, cert.Subject.CommonName) {
+		id.Rules = append(id.Rules, "allowed_cns")
+	}
+	for i := range tlsConfig.IdentityRules {
+		if tlsConfig.IdentityRules[i].Matches(cert) {
+			id.Rules = append(id.Rules, tlsConfig.IdentityRules[i].label(i))
+		}
+	}
+	if len(id.Rules) == 0 && tlsConfig.AllowAnyValidCert {
+		id.Rules = append(id.Rules, "allow_any_valid_cert")
+	}
+
+	return id, len(id.Rules) > 0
+}
+
+// globToRegexp converts a glob pattern with * and ? wildcards to an anchored regexp
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.Compile("^" + quoted + "$")
+}
+
+// certificateFingerprint returns the lowercase hex SHA-256 fingerprint of a certificate
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint strips separators from a hex fingerprint and lowercases it
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(fingerprint)
+	fingerprint = strings.NewReplacer(":", "", " ", "", "-", "").Replace(fingerprint)
+	return fingerprint
+}
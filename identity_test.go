@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClientCertificate creates a client certificate with subject and SAN
+// fields for the identity rule tests
+func newTestClientCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	spiffe, _ := url.Parse("spiffe://example.com/ns/ops/sa/board")
+	cert, err := generateCertificate(&x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "svc-backup",
+			Organization:       []string{"Example Corp"},
+			OrganizationalUnit: []string{"Storage", "SRE"},
+		},
+		EmailAddresses: []string{"backup@example.com"},
+		DNSNames:       []string{"backup.ops.example.com"},
+		URIs:           []*url.URL{spiffe},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, time.Hour, newTestCA(t, "test CA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.cert
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"admin", "admin", true},
+		{"admin", "evil-admin", false},
+		{"admin", "admin-x", false},
+		{"svc-*", "svc-backup", true},
+		{"svc-*", "svc-", true},
+		{"svc-*", "x-svc-backup", false},
+		{"*@example.com", "alice@example.com", true},
+		{"*@example.com", "alice@example.com.attacker.example", false},
+		{"*@example.com", "alice@example_com", false},
+		{"node-?", "node-1", true},
+		{"node-?", "node-12", false},
+		{"a.b", "axb", false},
+		{"(admin|root)", "admin", false},
+		{"(admin|root)", "(admin|root)", true},
+	}
+
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.pattern)
+		if err != nil {
+			t.Fatalf("globToRegexp(%q) failed: %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.value); got != tt.want {
+			t.Errorf("glob %q matches %q = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIdentityRuleMatches(t *testing.T) {
+	cert := newTestClientCertificate(t)
+	fingerprint := certificateFingerprint(cert)
+	var colons []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colons = append(colons, strings.ToUpper(fingerprint[i:i+2]))
+	}
+
+	tests := []struct {
+		name string
+		rule IdentityRule
+		want bool
+	}{
+		{"cn", IdentityRule{CN: "svc-backup"}, true},
+		{"cn glob", IdentityRule{CN: "svc-*"}, true},
+		{"cn prefix only", IdentityRule{CN: "svc"}, false},
+		{"cn regex", IdentityRule{CNRegex: "svc-[a-z]+"}, true},
+		{"cn regex is anchored", IdentityRule{CNRegex: "backup"}, false},
+		{"cn regex alternation is anchored", IdentityRule{CNRegex: "admin|svc-back"}, false},
+		{"cn regex alternation", IdentityRule{CNRegex: "admin|svc-backup"}, true},
+		{"organization", IdentityRule{Organization: "Example Corp"}, true},
+		{"other organization", IdentityRule{Organization: "Example"}, false},
+		{"any organizational unit", IdentityRule{OrganizationalUnit: "SRE"}, true},
+		{"other organizational unit", IdentityRule{OrganizationalUnit: "Dev"}, false},
+		{"all fields must match", IdentityRule{Organization: "Example Corp", OrganizationalUnit: "Dev"}, false},
+		{"subject fields", IdentityRule{Organization: "Example*", OrganizationalUnit: "S?E", CN: "svc-*"}, true},
+		{"san email", IdentityRule{SANEmail: "*@example.com"}, true},
+		{"other san email domain", IdentityRule{SANEmail: "*@example.org"}, false},
+		{"san dns", IdentityRule{SANDNS: "*.ops.example.com"}, true},
+		{"san dns of the cn", IdentityRule{SANDNS: "svc-backup"}, false},
+		{"san uri", IdentityRule{SANURI: "spiffe://example.com/ns/ops/*"}, true},
+		{"other san uri", IdentityRule{SANURI: "spiffe://example.com/ns/dev/*"}, false},
+		{"fingerprint", IdentityRule{FingerprintSHA256: fingerprint}, true},
+		{"fingerprint with colons", IdentityRule{FingerprintSHA256: strings.Join(colons, ":")}, true},
+		{"fingerprint with spaces", IdentityRule{FingerprintSHA256: strings.Join(colons, " ")}, true},
+		{"other fingerprint", IdentityRule{FingerprintSHA256: strings.Repeat("ab", 32)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.compile(); err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			if got := tt.rule.Matches(cert); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityRuleCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule IdentityRule
+	}{
+		{"no criteria", IdentityRule{Name: "empty"}},
+		{"invalid cn regex", IdentityRule{CNRegex: "svc-("}},
+		{"short fingerprint", IdentityRule{FingerprintSHA256: "AB:CD"}},
+		{"fingerprint with other characters", IdentityRule{FingerprintSHA256: strings.Repeat("zz", 32)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.compile(); err == nil {
+				t.Error("compile accepted the rule")
+			}
+		})
+	}
+}
+
+func TestMatchClientCertificate(t *testing.T) {
+	cert := newTestClientCertificate(t)
+
+	tests := []struct {
+		name      string
+		config    TLSConfig
+		wantRules []string // nil if the certificate must be rejected
+	}{
+		{"nothing configured", TLSConfig{}, nil},
+		{"allowed cn", TLSConfig{AllowedCNs: []string{"svc-backup"}}, []string{"allowed_cns"}},
+		{"other allowed cn", TLSConfig{AllowedCNs: []string{"svc"}}, nil},
+		{"named rule", TLSConfig{IdentityRules: []IdentityRule{{Name: "sre", OrganizationalUnit: "SRE"}}}, []string{"sre"}},
+		{"unnamed rule", TLSConfig{IdentityRules: []IdentityRule{{CN: "nobody"}, {CN: "svc-*"}}}, []string{"rule-2"}},
+		{"cn and rules", TLSConfig{
+			AllowedCNs:    []string{"svc-backup"},
+			IdentityRules: []IdentityRule{{Name: "sre", OrganizationalUnit: "SRE"}, {Name: "dev", OrganizationalUnit: "Dev"}},
+		}, []string{"allowed_cns", "sre"}},
+		{"any valid certificate", TLSConfig{AllowAnyValidCert: true}, []string{"allow_any_valid_cert"}},
+		{"any valid certificate after no match", TLSConfig{
+			AllowAnyValidCert: true,
+			IdentityRules:     []IdentityRule{{Name: "dev", OrganizationalUnit: "Dev"}},
+		}, []string{"allow_any_valid_cert"}},
+		{"any valid certificate not reported with a match", TLSConfig{
+			AllowAnyValidCert: true,
+			AllowedCNs:        []string{"svc-backup"},
+			IdentityRules:     []IdentityRule{{Name: "sre", OrganizationalUnit: "SRE"}},
+		}, []string{"allowed_cns", "sre"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := compileIdentityRules(&tt.config); err != nil {
+				t.Fatal(err)
+			}
+			id, allowed := matchClientCertificate(&tt.config, cert)
+			if allowed != (tt.wantRules != nil) {
+				t.Fatalf("allowed = %v, want %v", allowed, tt.wantRules != nil)
+			}
+			if !slices.Equal(id.Rules, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", id.Rules, tt.wantRules)
+			}
+			if allowed && (id.Name != "svc-backup" || id.Access != accessAdmin) {
+				t.Errorf("identity = %+v", id)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Lifecycle runs the HTTP server together with its background goroutines and
+// shuts everything down gracefully on SIGINT or SIGTERM
+type Lifecycle struct {
+	ctx     context.Context
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+	mutex   sync.Mutex
+	closers []lifecycleCloser
+	logger  *slog.Logger
+}
+
+// lifecycleCloser releases a resource on shutdown
+type lifecycleCloser struct {
+	name  string
+	close func() error
+}
+
+// NewLifecycle creates a lifecycle whose context is cancelled on SIGINT or SIGTERM
+func NewLifecycle() *Lifecycle {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	return &Lifecycle{
+		ctx:    ctx,
+		stop:   stop,
+		logger: slog.With("component", "lifecycle"),
+	}
+}
+
+// Context returns the context that is cancelled when shutdown begins
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Go runs fn in a background goroutine. fn must return once ctx is cancelled;
+// shutdown waits for it.
+func (l *Lifecycle) Go(name string, fn func(ctx context.Context)) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		fn(l.ctx)
+		l.logger.Debug("Background task stopped", "task", name)
+	}()
+}
+
+// OnShutdown registers a cleanup function. Cleanup functions run in reverse
+// order of registration after the server and background goroutines stopped.
+func (l *Lifecycle) OnShutdown(name string, close func() error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closers = append(l.closers, lifecycleCloser{name: name, close: close})
+}
+
+// Run serves HTTP, or HTTPS if the server has a TLS config, until a shutdown
+// signal arrives or the server fails, then shuts down within the server's
+// shutdown timeout
+func (l *Lifecycle) Run(server *http.Server, shutdownTimeout time.Duration) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			serverErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	var runErr error
+	select {
+	case err := <-serverErr:
+		if err != nil && err != http.ErrServerClosed {
+			runErr = err
+		}
+	case <-l.ctx.Done():
+		l.logger.Info("Received shutdown signal, shutting down gracefully", "timeout", shutdownTimeout)
+	}
+
+	// Restore default signal handling, a second signal terminates immediately
+	l.stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		l.logger.Warn("Server shutdown error, closing remaining connections", "error", err)
+		server.Close()
+	} else {
+		l.logger.Info("Server stopped, all in-flight requests completed")
+	}
+
+	// Wait for background goroutines
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		l.logger.Warn("Timed out waiting for background tasks")
+	}
+
+	l.mutex.Lock()
+	closers := l.closers
+	l.mutex.Unlock()
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].close(); err != nil {
+			l.logger.Error("Cleanup error", "resource", closers[i].name, "error", err)
+		} else {
+			l.logger.Debug("Stopped", "resource", closers[i].name)
+		}
+	}
+
+	return runErr
+}
+
+// newHTTPServer creates the HTTP server with the configured timeouts
+func newHTTPServer(config *Config, listenAddr string, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:              listenAddr,
+		Handler:           accessLogMiddleware(securityHeadersMiddleware(basePathMiddleware(config.Server.BasePath, http.DefaultServeMux))),
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       config.Server.ReadTimeout,
+		ReadHeaderTimeout: config.Server.ReadHeaderTimeout,
+		WriteTimeout:      config.Server.WriteTimeout,
+		IdleTimeout:       config.Server.IdleTimeout,
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// accessLogEnabled controls the access log, set by the -access-log flag
+var accessLogEnabled = true
+
+// setupLogging installs the default structured logger. The standard log
+// package is routed through it as well.
+func setupLogging(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q, use debug, info, warn or error", level)
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	default:
+		return fmt.Errorf("invalid log format %q, use text or json", format)
+	}
+
+	// The handler adds the time, the standard log package must not
+	log.SetFlags(0)
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// accessLogEntry collects the details of a request for the access log. The
+// proxy handler fills in the upstream fields.
+type accessLogEntry struct {
+	User            string
+	ESMethod        string
+	ESPath          string
+	UpstreamStatus  int
+	UpstreamLatency time.Duration
+	Cache           string
+}
+
+type accessLogContextKey struct{}
+
+// accessLogFromContext returns the access log entry of the request, if any
+func accessLogFromContext(ctx context.Context) *accessLogEntry {
+	entry, _ := ctx.Value(accessLogContextKey{}).(*accessLogEntry)
+	return entry
+}
+
+// accessLogWriter records the status and size of a response
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush supports streaming responses
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLogMiddleware logs every request with the client identity and, for
+// proxied requests, the Elasticsearch path, upstream status and latency
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accessLogEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		entry := &accessLogEntry{}
+		lw := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), accessLogContextKey{}, entry)))
+
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+		user := entry.User
+		if user == "" {
+			user = "-"
+		}
+		attrs := []any{
+			"remote", r.RemoteAddr,
+			"user", user,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", lw.status,
+			"bytes", lw.bytes,
+			"duration_ms", milliseconds(time.Since(start)),
+		}
+		if entry.ESPath != "" {
+			attrs = append(attrs,
+				"es_method", entry.ESMethod,
+				"es_path", entry.ESPath,
+				"upstream_status", entry.UpstreamStatus,
+				"upstream_latency_ms", milliseconds(entry.UpstreamLatency),
+			)
+		}
+		if entry.Cache != "" {
+			attrs = append(attrs, "cache", entry.Cache)
+		}
+
+		// Keep probes and scrapes out of the default log
+		level := slog.LevelInfo
+		if path := strings.TrimPrefix(r.URL.Path, basePath); path == "/healthz" || path == "/readyz" || path == "/metrics" {
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "access", attrs...)
+	})
+}
+
+// milliseconds converts a duration to fractional milliseconds for log fields
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	accessAdmin    = "admin"
+	accessReadOnly = "read-only"
+
+	sessionCookieName   = "geb_session"
+	oidcStateCookieName = "geb_oidc_state"
+)
+
+// OIDCConfig holds the OpenID Connect single sign-on configuration
+type OIDCConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	IssuerURL     string            `yaml:"issuer_url"`
+	ClientID      string            `yaml:"client_id"`
+	ClientSecret  string            `yaml:"client_secret"`
+	RedirectURL   string            `yaml:"redirect_url"`
+	Scopes        []string          `yaml:"scopes"`
+	UsernameClaim string            `yaml:"username_claim"`
+	GroupsClaim   string            `yaml:"groups_claim"`
+	GroupAccess   map[string]string `yaml:"group_access"`
+	SessionSecret string            `yaml:"session_secret"`
+	SessionTTL    time.Duration     `yaml:"session_ttl"`
+}
+
+// oidcSession is the payload of the signed session cookie
+type oidcSession struct {
+	Name    string    `json:"name"`
+	Groups  []string  `json:"groups,omitempty"`
+	Access  string    `json:"access"`
+	Expires time.Time `json:"exp"`
+}
+
+// oidcLoginState is the payload of the signed cookie that carries the login
+// state from /auth/login to /auth/callback
+type oidcLoginState struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	ReturnTo string    `json:"return_to"`
+	Expires  time.Time `json:"exp"`
+}
+
+// OIDCAuthenticator implements the OpenID Connect authorization code flow with
+// signed session cookies
+type OIDCAuthenticator struct {
+	config   OIDCConfig
+	secret   []byte
+	mutex    sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth2   *oauth2.Config
+}
+
+var oidcAuth *OIDCAuthenticator
+
+// validateOIDCConfig checks the OIDC configuration and fills in defaults
+func validateOIDCConfig(cfg *OIDCConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	required := []struct{ name, value string }{
+		{"oidc.issuer_url", cfg.IssuerURL},
+		{"oidc.client_id", cfg.ClientID},
+		{"oidc.redirect_url", cfg.RedirectURL},
+		{"oidc.session_secret", cfg.SessionSecret},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			return fmt.Errorf("%s is required when OIDC is enabled", field.name)
+		}
+	}
+	if len(cfg.SessionSecret) < 32 {
+		return fmt.Errorf("oidc.session_secret must be at least 32 characters long")
+	}
+	for group, access := range cfg.GroupAccess {
+		if access != accessAdmin && access != accessReadOnly {
+			return fmt.Errorf("oidc.group_access[%s] must be %q or %q, got %q", group, accessAdmin, accessReadOnly, access)
+		}
+	}
+	if len(cfg.GroupAccess) == 0 {
+		slog.Warn("oidc.group_access is empty, all OIDC users will be rejected")
+	}
+
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	} else if !slices.Contains(cfg.Scopes, oidc.ScopeOpenID) {
+		cfg.Scopes = append([]string{oidc.ScopeOpenID}, cfg.Scopes...)
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 8 * time.Hour
+	}
+	return nil
+}
+
+// NewOIDCAuthenticator creates an authenticator. The identity provider is
+// discovered on first use, so an unreachable provider does not block startup.
+func NewOIDCAuthenticator(config OIDCConfig) *OIDCAuthenticator {
+	return &OIDCAuthenticator{
+		config: config,
+		secret: []byte(config.SessionSecret),
+	}
+}
+
+// setup discovers the identity provider, retrying on later calls if it fails
+func (oa *OIDCAuthenticator) setup(ctx context.Context) error {
+	oa.mutex.Lock()
+	defer oa.mutex.Unlock()
+
+	if oa.provider != nil {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, oa.config.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("failed to discover OIDC provider %s: %v", oa.config.IssuerURL, err)
+	}
+
+	oa.provider = provider
+	oa.verifier = provider.Verifier(&oidc.Config{ClientID: oa.config.ClientID})
+	oa.oauth2 = &oauth2.Config{
+		ClientID:     oa.config.ClientID,
+		ClientSecret: oa.config.ClientSecret,
+		RedirectURL:  oa.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       oa.config.Scopes,
+	}
+	slog.Info("OIDC provider discovered", "issuer", oa.config.IssuerURL)
+	return nil
+}
+
+// SessionIdentity returns the identity of a valid session cookie
+func (oa *OIDCAuthenticator) SessionIdentity(r *http.Request) (Identity, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return Identity{}, false
+	}
+
+	var session oidcSession
+	if err := oa.decodeCookie(sessionCookieName, cookie.Value, &session); err != nil {
+		slog.Debug("Ignoring invalid session cookie", "error", err)
+		return Identity{}, false
+	}
+	if time.Now().After(session.Expires) {
+		return Identity{}, false
+	}
+	if session.Name == "" || (session.Access != accessAdmin && session.Access != accessReadOnly) {
+		slog.Warn("Ignoring session cookie without user or access level", "remote", r.RemoteAddr)
+		return Identity{}, false
+	}
+
+	return Identity{
+		Name:   session.Name,
+		Source: "oidc",
+		Groups: session.Groups,
+		Access: session.Access,
+	}, true
+}
+
+// RequireLogin redirects browsers to the login page and answers API clients with 401
+func (oa *OIDCAuthenticator) RequireLogin(w http.ResponseWriter, r *http.Request) {
+	loginURL := withBasePath("/auth/login?return_to=" + url.QueryEscape(withBasePath(r.URL.RequestURI())))
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, loginURL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":     "login_required",
+		"login_url": withBasePath("/auth/login"),
+	})
+}
+
+// LoginHandler starts the authorization code flow
+func (oa *OIDCAuthenticator) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if err := oa.setup(r.Context()); err != nil {
+		slog.Error("OIDC login failed", "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	state := oidcLoginState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: safeReturnTo(r.URL.Query().Get("return_to")),
+		Expires:  time.Now().Add(10 * time.Minute),
+	}
+	value, err := oa.encodeCookie(oidcStateCookieName, state)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    value,
+		Path:     withBasePath("/auth/"),
+		Expires:  state.Expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authURL := oa.oauth2.AuthCodeURL(state.State, oidc.Nonce(state.Nonce), oauth2.S256ChallengeOption(state.Verifier))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// CallbackHandler completes the authorization code flow and creates the session
+func (oa *OIDCAuthenticator) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if err := oa.setup(r.Context()); err != nil {
+		slog.Warn("OIDC callback failed", "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		http.Error(w, "Login state missing, please retry the login", http.StatusBadRequest)
+		return
+	}
+	var state oidcLoginState
+	if err := oa.decodeCookie(oidcStateCookieName, cookie.Value, &state); err != nil || time.Now().After(state.Expires) {
+		http.Error(w, "Login state invalid or expired, please retry the login", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookieName, Path: withBasePath("/auth/"), MaxAge: -1})
+
+	if errParam := r.URL.Query().Get("error"); errParam != "" {
+		slog.Warn("OIDC login failed at identity provider", "error", errParam, "description", r.URL.Query().Get("error_description"))
+		http.Error(w, "Login failed: "+errParam, http.StatusUnauthorized)
+		return
+	}
+	if !hmac.Equal([]byte(r.URL.Query().Get("state")), []byte(state.State)) {
+		http.Error(w, "Login state mismatch", http.StatusBadRequest)
+		return
+	}
+
+	token, err := oa.oauth2.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		slog.Warn("OIDC code exchange failed", "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "Login failed: no ID token returned", http.StatusUnauthorized)
+		return
+	}
+	idToken, err := oa.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		slog.Warn("OIDC ID token verification failed", "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	if !hmac.Equal([]byte(idToken.Nonce), []byte(state.Nonce)) {
+		http.Error(w, "Login failed: nonce mismatch", http.StatusUnauthorized)
+		return
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, "Login failed: invalid claims", http.StatusUnauthorized)
+		return
+	}
+
+	name := claimString(claims, oa.config.UsernameClaim)
+	if name == "" {
+		name = claimString(claims, "email")
+	}
+	if name == "" {
+		name = idToken.Subject
+	}
+	groups := claimStrings(claims, oa.config.GroupsClaim)
+
+	access := oa.accessForGroups(groups)
+	if access == "" {
+		slog.Warn("Rejected OIDC user, none of the groups is mapped in oidc.group_access", "user", name, "groups", groups)
+		http.Error(w, "Not authorized", http.StatusForbidden)
+		return
+	}
+
+	session := oidcSession{
+		Name:    name,
+		Groups:  groups,
+		Access:  access,
+		Expires: time.Now().Add(oa.config.SessionTTL),
+	}
+	value, err := oa.encodeCookie(sessionCookieName, session)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     withBasePath("/"),
+		Expires:  session.Expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	slog.Info("OIDC user logged in", "user", name, "access", access)
+	http.Redirect(w, r, state.ReturnTo, http.StatusFound)
+}
+
+// LogoutHandler removes the session cookie
+func (oa *OIDCAuthenticator) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: withBasePath("/"), MaxAge: -1})
+	http.Redirect(w, r, withBasePath("/"), http.StatusFound)
+}
+
+// accessForGroups maps group claims to the highest access level granted
+func (oa *OIDCAuthenticator) accessForGroups(groups []string) string {
+	access := ""
+	for _, group := range groups {
+		switch oa.config.GroupAccess[group] {
+		case accessAdmin:
+			return accessAdmin
+		case accessReadOnly:
+			access = accessReadOnly
+		}
+	}
+	return access
+}
+
+// encodeCookie serializes and signs a cookie payload. The signature covers the
+// cookie name, so a cookie is only accepted under the name it was issued for.
+func (oa *OIDCAuthenticator) encodeCookie(name string, payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + oa.sign(name, encoded), nil
+}
+
+// decodeCookie verifies the signature of the value of the named cookie and
+// decodes its payload
+func (oa *OIDCAuthenticator) decodeCookie(name, value string, payload any) error {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(oa.sign(name, encoded))) {
+		return fmt.Errorf("invalid signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, payload)
+}
+
+// sign returns the HMAC-SHA256 signature of the value of the named cookie
+func (oa *OIDCAuthenticator) sign(name, value string) string {
+	mac := hmac.New(sha256.New, oa.secret)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// randomToken returns a random URL-safe string
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// safeReturnTo only allows redirects to local paths of the board after the login
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, withBasePath("/")) || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return withBasePath("/")
+	}
+	return returnTo
+}
+
+// claimString returns a string claim
+func claimString(claims map[string]any, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// claimStrings returns a claim that is either a list of strings or a single string
+func claimStrings(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "board"
+	testClientSecret = "board-secret"
+)
+
+// mockGrant is an authorization code issued by the mock identity provider
+type mockGrant struct {
+	challenge string
+	nonce     string
+	claims    map[string]any
+}
+
+// mockIdP is an OpenID Connect provider serving discovery, JWKS and the token
+// endpoint. Tests issue authorization codes directly instead of logging in at
+// an authorization endpoint.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	mutex  sync.Mutex
+	codes  map[string]mockGrant
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, codes: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.tokenHandler)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// issue returns a new authorization code for the PKCE challenge and nonce of
+// a login, which yields an ID token with the claims
+func (idp *mockIdP) issue(challenge, nonce string, claims map[string]any) string {
+	idp.mutex.Lock()
+	defer idp.mutex.Unlock()
+	code := randomToken()
+	idp.codes[code] = mockGrant{challenge: challenge, nonce: nonce, claims: claims}
+	return code
+}
+
+// tokenHandler exchanges an authorization code once, if the client
+// credentials and the PKCE verifier match
+func (idp *mockIdP) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	idp.mutex.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mutex.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || clientID != testClientID || clientSecret != testClientSecret ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   idp.server.URL,
+		"aud":   testClientID,
+		"sub":   "user-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": randomToken(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idp.sign(claims),
+	})
+}
+
+// sign returns the claims as a JWT signed with RS256
+func (idp *mockIdP) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// newTestOIDCAuthenticator returns an authenticator using the mock identity provider
+func newTestOIDCAuthenticator(t *testing.T, idp *mockIdP) *OIDCAuthenticator {
+	t.Helper()
+	cfg := OIDCConfig{
+		Enabled:       true,
+		IssuerURL:     idp.server.URL,
+		ClientID:      testClientID,
+		ClientSecret:  testClientSecret,
+		RedirectURL:   "https://board.example/auth/callback",
+		SessionSecret: strings.Repeat("s", 32),
+		GroupAccess:   map[string]string{"ops": accessAdmin, "dev": accessReadOnly},
+	}
+	if err := validateOIDCConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	return NewOIDCAuthenticator(cfg)
+}
+
+// startLogin runs the login handler and returns the authorization request
+// parameters and the login state cookie
+func startLogin(t *testing.T, oa *OIDCAuthenticator, returnTo string) (url.Values, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	oa.LoginHandler(rec, httptest.NewRequest("GET", "/auth/login?return_to="+url.QueryEscape(returnTo), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login returned %d: %s", rec.Code, rec.Body)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := location.Query()
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		t.Fatalf("login did not request PKCE: %s", location)
+	}
+	if params.Get("state") == "" || params.Get("nonce") == "" {
+		t.Fatalf("login did not send a state and nonce: %s", location)
+	}
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == oidcStateCookieName {
+			return params, cookie
+		}
+	}
+	t.Fatal("login did not set the state cookie")
+	return nil, nil
+}
+
+// callback runs the callback handler with the query and cookie
+func callback(oa *OIDCAuthenticator, query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/auth/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	oa.CallbackHandler(rec, r)
+	return rec
+}
+
+// sessionCookie returns the session cookie set by a response
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookieName && cookie.MaxAge >= 0 {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newMockIdP(t)
+
+	tests := []struct {
+		name     string
+		returnTo string
+		claims   map[string]any
+		wantTo   string
+		wantUser string
+		want     string // access level of the session
+	}{
+		{"admin group", "/indices?sort=name", map[string]any{"preferred_username": "alice", "groups": []string{"dev", "ops"}}, "/indices?sort=name", "alice", accessAdmin},
+		{"read-only group", "/", map[string]any{"preferred_username": "bob", "groups": []string{"dev"}}, "/", "bob", accessReadOnly},
+		{"single group string", "/", map[string]any{"email": "carol@example.com", "groups": "ops"}, "/", "carol@example.com", accessAdmin},
+		{"subject without username", "/", map[string]any{"groups": []string{"dev"}}, "/", "user-1", accessReadOnly},
+		{"external return to", "https://attacker.example/", map[string]any{"preferred_username": "alice", "groups": []string{"ops"}}, "/", "alice", accessAdmin},
+		{"protocol relative return to", "//attacker.example/", map[string]any{"preferred_username": "alice", "groups": []string{"ops"}}, "/", "alice", accessAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oa := newTestOIDCAuthenticator(t, idp)
+			params, stateCookie := startLogin(t, oa, tt.returnTo)
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), tt.claims)
+
+			rec := callback(oa, url.Values{"code": {code}, "state": {params.Get("state")}}, stateCookie)
+			if rec.Code != http.StatusFound {
+				t.Fatalf("callback returned %d: %s", rec.Code, rec.Body)
+			}
+			if location := rec.Header().Get("Location"); location != tt.wantTo {
+				t.Errorf("callback redirected to %q, want %q", location, tt.wantTo)
+			}
+
+			cookie := sessionCookie(rec)
+			if cookie == nil {
+				t.Fatal("callback did not set a session cookie")
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(cookie)
+			id, ok := oa.SessionIdentity(r)
+			if !ok {
+				t.Fatal("session cookie not accepted")
+			}
+			if id.Name != tt.wantUser || id.Access != tt.want || id.Source != "oidc" {
+				t.Errorf("session identity = %+v, want %s with %s access", id, tt.wantUser, tt.want)
+			}
+
+			// The code can only be exchanged once
+			if rec := callback(oa, url.Values{"code": {code}, "state": {params.Get("state")}}, stateCookie); rec.Code == http.StatusFound {
+				t.Error("authorization code accepted twice")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejections(t *testing.T) {
+	idp := newMockIdP(t)
+	claims := map[string]any{"preferred_username": "alice", "groups": []string{"ops"}}
+
+	tests := []struct {
+		name string
+		// callback returns the query and cookie of the callback request for a
+		// login started with params and stateCookie
+		callback func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie)
+		want     int
+	}{
+		{"missing state cookie", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), claims)
+			return url.Values{"code": {code}, "state": {params.Get("state")}}, nil
+		}, http.StatusBadRequest},
+		{"state mismatch", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), claims)
+			return url.Values{"code": {code}, "state": {randomToken()}}, stateCookie
+		}, http.StatusBadRequest},
+		{"state cookie of another login", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			_, otherCookie := startLogin(t, oa, "/")
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), claims)
+			return url.Values{"code": {code}, "state": {params.Get("state")}}, otherCookie
+		}, http.StatusBadRequest},
+		{"tampered state cookie", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			var state oidcLoginState
+			if err := oa.decodeCookie(oidcStateCookieName, stateCookie.Value, &state); err != nil {
+				t.Fatal(err)
+			}
+			state.State = "forged"
+			payload, _ := json.Marshal(state)
+			_, signature, _ := strings.Cut(stateCookie.Value, ".")
+			forged := &http.Cookie{Name: oidcStateCookieName, Value: base64.RawURLEncoding.EncodeToString(payload) + "." + signature}
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), claims)
+			return url.Values{"code": {code}, "state": {"forged"}}, forged
+		}, http.StatusBadRequest},
+		{"state cookie signed with another secret", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			other := NewOIDCAuthenticator(OIDCConfig{SessionSecret: strings.Repeat("x", 32)})
+			value, _ := other.encodeCookie(oidcStateCookieName, oidcLoginState{State: "forged", Expires: time.Now().Add(time.Minute)})
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), claims)
+			return url.Values{"code": {code}, "state": {"forged"}}, &http.Cookie{Name: oidcStateCookieName, Value: value}
+		}, http.StatusBadRequest},
+		{"expired state cookie", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			var state oidcLoginState
+			if err := oa.decodeCookie(oidcStateCookieName, stateCookie.Value, &state); err != nil {
+				t.Fatal(err)
+			}
+			state.Expires = time.Now().Add(-time.Second)
+			value, _ := oa.encodeCookie(oidcStateCookieName, state)
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), claims)
+			return url.Values{"code": {code}, "state": {params.Get("state")}}, &http.Cookie{Name: oidcStateCookieName, Value: value}
+		}, http.StatusBadRequest},
+		{"error from identity provider", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			return url.Values{"error": {"access_denied"}, "state": {params.Get("state")}}, stateCookie
+		}, http.StatusUnauthorized},
+		{"code for another PKCE challenge", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			code := idp.issue("another-challenge", params.Get("nonce"), claims)
+			return url.Values{"code": {code}, "state": {params.Get("state")}}, stateCookie
+		}, http.StatusUnauthorized},
+		{"unknown code", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			return url.Values{"code": {"unknown"}, "state": {params.Get("state")}}, stateCookie
+		}, http.StatusUnauthorized},
+		{"nonce mismatch", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			code := idp.issue(params.Get("code_challenge"), "another-nonce", claims)
+			return url.Values{"code": {code}, "state": {params.Get("state")}}, stateCookie
+		}, http.StatusUnauthorized},
+		{"unmapped groups", func(oa *OIDCAuthenticator, params url.Values, stateCookie *http.Cookie) (url.Values, *http.Cookie) {
+			code := idp.issue(params.Get("code_challenge"), params.Get("nonce"), map[string]any{"preferred_username": "mallory", "groups": []string{"guests"}})
+			return url.Values{"code": {code}, "state": {params.Get("state")}}, stateCookie
+		}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oa := newTestOIDCAuthenticator(t, idp)
+			params, stateCookie := startLogin(t, oa, "/")
+			query, cookie := tt.callback(oa, params, stateCookie)
+
+			rec := callback(oa, query, cookie)
+			if rec.Code != tt.want {
+				t.Errorf("callback returned %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if sessionCookie(rec) != nil {
+				t.Error("callback set a session cookie")
+			}
+		})
+	}
+}
+
+func TestDecodeCookie(t *testing.T) {
+	oa := NewOIDCAuthenticator(OIDCConfig{SessionSecret: strings.Repeat("s", 32)})
+	value, err := oa.encodeCookie(sessionCookieName, oidcSession{Name: "alice", Access: accessReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, signature, _ := strings.Cut(value, ".")
+	forged, _ := json.Marshal(oidcSession{Name: "alice", Access: accessAdmin})
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"valid", value, false},
+		{"no signature", encoded, true},
+		{"empty signature", encoded + ".", true},
+		{"wrong signature", encoded + "." + oa.sign(sessionCookieName, "other"), true},
+		{"modified payload", base64.RawURLEncoding.EncodeToString(forged) + "." + signature, true},
+		{"signed with another secret", encoded + "." + NewOIDCAuthenticator(OIDCConfig{SessionSecret: strings.Repeat("x", 32)}).sign(sessionCookieName, encoded), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var session oidcSession
+			err := oa.decodeCookie(sessionCookieName, tt.value, &session)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeCookie accepted %q as %+v", tt.value, session)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeCookie failed: %v", err)
+			}
+			if session.Name != "alice" || session.Access != accessReadOnly {
+				t.Errorf("decodeCookie = %+v", session)
+			}
+		})
+	}
+}
+
+func TestSafeReturnTo(t *testing.T) {
+	tests := []struct {
+		basePath string
+		returnTo string
+		want     string
+	}{
+		{"", "/", "/"},
+		{"", "/indices?sort=name", "/indices?sort=name"},
+		{"", "", "/"},
+		{"", "indices", "/"},
+		{"", "https://attacker.example/", "/"},
+		{"", "//attacker.example/", "/"},
+		{"", `/\attacker.example/`, "/"},
+		{"", "javascript:alert(1)", "/"},
+		{"/tools/board", "/tools/board/indices", "/tools/board/indices"},
+		{"/tools/board", "/tools/board/", "/tools/board/"},
+		{"/tools/board", "/other/", "/tools/board/"},
+		{"/tools/board", "/tools/boardx", "/tools/board/"},
+		{"/tools/board", "//attacker.example/tools/board/", "/tools/board/"},
+	}
+
+	defer func(prefix string) { basePath = prefix }(basePath)
+	for _, tt := range tests {
+		basePath = tt.basePath
+		if got := safeReturnTo(tt.returnTo); got != tt.want {
+			t.Errorf("safeReturnTo(%q) with base path %q = %q, want %q", tt.returnTo, tt.basePath, got, tt.want)
+		}
+	}
+}
+
+func TestAccessForGroups(t *testing.T) {
+	oa := NewOIDCAuthenticator(OIDCConfig{GroupAccess: map[string]string{"ops": accessAdmin, "dev": accessReadOnly}})
+
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"guests"}, ""},
+		{[]string{"dev"}, accessReadOnly},
+		{[]string{"ops"}, accessAdmin},
+		{[]string{"dev", "ops"}, accessAdmin},
+		{[]string{"ops", "dev"}, accessAdmin},
+		{[]string{"guests", "dev"}, accessReadOnly},
+		{[]string{"OPS"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := oa.accessForGroups(tt.groups); got != tt.want {
+			t.Errorf("accessForGroups(%v) = %q, want %q", tt.groups, got, tt.want)
+		}
+	}
+}
+
+func TestSessionIdentityRejectsOtherCookies(t *testing.T) {
+	idp := newMockIdP(t)
+	oa := newTestOIDCAuthenticator(t, idp)
+	_, stateCookie := startLogin(t, oa, "/")
+	expires := time.Now().Add(time.Hour)
+
+	sessionValue := func(session oidcSession) string {
+		value, err := oa.encodeCookie(sessionCookieName, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"valid session", sessionValue(oidcSession{Name: "alice", Access: accessAdmin, Expires: expires}), true},
+		{"login state cookie", stateCookie.Value, false},
+		{"login state payload", func() string {
+			value, _ := oa.encodeCookie(oidcStateCookieName, oidcSession{Name: "alice", Access: accessAdmin, Expires: expires})
+			return value
+		}(), false},
+		{"no user", sessionValue(oidcSession{Access: accessAdmin, Expires: expires}), false},
+		{"no access level", sessionValue(oidcSession{Name: "alice", Expires: expires}), false},
+		{"unknown access level", sessionValue(oidcSession{Name: "alice", Access: "root", Expires: expires}), false},
+		{"expired", sessionValue(oidcSession{Name: "alice", Access: accessAdmin, Expires: time.Now().Add(-time.Second)}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.value})
+			if id, ok := oa.SessionIdentity(r); ok != tt.want {
+				t.Errorf("SessionIdentity = %+v, %v, want %v", id, ok, tt.want)
+			}
+		})
+	}
+
+	// Nor is a session cookie accepted as login state
+	session := &http.Cookie{Name: oidcStateCookieName, Value: sessionValue(oidcSession{Name: "alice", Access: accessAdmin, Expires: expires})}
+	if rec := callback(oa, url.Values{"code": {"unknown"}, "state": {""}}, session); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback with a session cookie as login state returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
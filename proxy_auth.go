@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Identity headers set by TLS terminating reverse proxies
+const (
+	headerForwardedClientCert = "X-Forwarded-Client-Cert" // Envoy
+	headerSSLClientCert       = "X-SSL-Client-Cert"       // nginx $ssl_client_escaped_cert
+	headerSSLClientSubjectDN  = "X-SSL-Client-S-DN"       // nginx $ssl_client_s_dn
+	headerRemoteUser          = "X-Remote-User"
+)
+
+var proxyIdentityHeaders = []string{
+	headerForwardedClientCert,
+	headerSSLClientCert,
+	headerSSLClientSubjectDN,
+	headerRemoteUser,
+}
+
+// ProxyAuthConfig holds the configuration for client identities passed by a
+// trusted reverse proxy that terminates TLS
+type ProxyAuthConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Header is the one identity header the proxy sets. There is no default:
+	// a proxy passes headers it does not set through from the client.
+	Header string `yaml:"header"`
+
+	trusted []netip.Prefix
+}
+
+// validateProxyAuthConfig checks the proxy auth configuration, parses the
+// trusted proxy CIDRs and fills in defaults
+func validateProxyAuthConfig(cfg *ProxyAuthConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if len(cfg.TrustedProxies) == 0 {
+		return fmt.Errorf("proxy_auth.trusted_proxies is required when proxy auth is enabled")
+	}
+	cfg.trusted = nil
+	for _, cidr := range cfg.TrustedProxies {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return fmt.Errorf("proxy_auth.trusted_proxies: invalid CIDR or address %q", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cfg.trusted = append(cfg.trusted, prefix.Masked())
+	}
+
+	if cfg.Header == "" {
+		return fmt.Errorf("proxy_auth.header is required when proxy auth is enabled, supported are %s", strings.Join(proxyIdentityHeaders, ", "))
+	}
+	known := slices.IndexFunc(proxyIdentityHeaders, func(h string) bool { return strings.EqualFold(h, cfg.Header) })
+	if known < 0 {
+		return fmt.Errorf("proxy_auth.header: unsupported header %q, supported are %s", cfg.Header, strings.Join(proxyIdentityHeaders, ", "))
+	}
+	cfg.Header = proxyIdentityHeaders[known]
+	return nil
+}
+
+// Trusts checks if the request was sent by a configured trusted proxy
+func (cfg *ProxyAuthConfig) Trusts(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return slices.ContainsFunc(cfg.trusted, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// identityHeader returns the value of the configured identity header. Any
+// other identity header on the request is an error: the proxy does not set
+// it, so it came from the client.
+func (cfg *ProxyAuthConfig) identityHeader(r *http.Request) (string, error) {
+	for _, header := range proxyIdentityHeaders {
+		if header != cfg.Header && strings.TrimSpace(r.Header.Get(header)) != "" {
+			return "", fmt.Errorf("unexpected identity header %s, only %s is accepted", header, cfg.Header)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get(cfg.Header)), nil
+}
+
+// proxyHeaderAuth authenticates a request from a trusted proxy by its identity
+// header, applying the same allow-list and identity rules as client certificates
+func proxyHeaderAuth(next http.Handler, header, value string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := configManager.Get()
+
+		cert, complete, err := proxyClientCertificate(header, value)
+		if err != nil {
+			slog.Warn("Rejected invalid client identity header", "header", header, "remote", r.RemoteAddr, "error", err)
+			http.Error(w, "Invalid client identity header", http.StatusBadRequest)
+			return
+		}
+		clientCN := cert.Subject.CommonName
+
+		if complete && certManager != nil {
+			if revokedAt, ok := certManager.IsRevoked(cert); ok {
+				slog.Warn("Rejected revoked client certificate according to CRL",
+					"cn", clientCN, "serial", cert.SerialNumber.String(), "issuer", cert.Issuer.String(), "header", header, "revoked_at", revokedAt)
+				http.Error(w, "Client certificate revoked", http.StatusForbidden)
+				return
+			}
+		}
+
+		identity, allowed := matchClientCertificate(&config.TLS, cert)
+		if !allowed {
+			slog.Debug("Client CN not in allowed list and matches no identity rule", "cn", clientCN, "header", header, "allowed_cns", config.TLS.AllowedCNs)
+			http.Error(w, "Client not authorized", http.StatusForbidden)
+			return
+		}
+		identity.Source = "proxy-header:" + header
+
+		slog.Debug("Client authenticated", "cn", clientCN, "header", header, "remote", r.RemoteAddr, "rules", identity.Rules)
+
+		next.ServeHTTP(w, withIdentity(r, identity))
+	})
+}
+
+// proxyClientCertificate turns an identity header into a certificate that the
+// identity rules can be matched against. complete reports whether the header
+// carried the full client certificate or only its subject.
+func proxyClientCertificate(header, value string) (cert *x509.Certificate, complete bool, err error) {
+	switch header {
+	case headerForwardedClientCert:
+		return parseForwardedClientCert(value)
+	case headerSSLClientCert:
+		cert, err := parseEscapedCertificate(value)
+		return cert, err == nil, err
+	case headerSSLClientSubjectDN:
+		subject, err := parseDistinguishedName(value)
+		if err != nil {
+			return nil, false, err
+		}
+		return &x509.Certificate{Subject: subject}, false, nil
+	default:
+		return &x509.Certificate{Subject: pkix.Name{CommonName: value}}, false, nil
+	}
+}
+
+// parseForwardedClientCert parses the Envoy X-Forwarded-Client-Cert header,
+// e.g. By=spiffe://board;Hash=...;Cert="-----BEGIN...";Subject="CN=alice,O=Example".
+// Only the element added by the last proxy is used.
+func parseForwardedClientCert(value string) (*x509.Certificate, bool, error) {
+	elements := splitQuoted(value, ',')
+	fields := make(map[string]string)
+	for _, pair := range splitQuoted(elements[len(elements)-1], ';') {
+		key, val, _ := strings.Cut(pair, "=")
+		fields[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+
+	if fields["cert"] != "" {
+		cert, err := parseEscapedCertificate(fields["cert"])
+		return cert, err == nil, err
+	}
+	if fields["subject"] != "" {
+		subject, err := parseDistinguishedName(fields["subject"])
+		if err != nil {
+			return nil, false, err
+		}
+		return &x509.Certificate{Subject: subject}, false, nil
+	}
+	return nil, false, fmt.Errorf("neither Cert nor Subject is set")
+}
+
+// parseEscapedCertificate parses a URL-escaped PEM certificate
+func parseEscapedCertificate(value string) (*x509.Certificate, error) {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unescape certificate: %v", err)
+	}
+	certs, err := parseCertificates([]byte(unescaped))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return certs[0], nil
+}
+
+// parseDistinguishedName parses a subject in RFC 2253 form (CN=alice,O=Example)
+// or the legacy OpenSSL form (/O=Example/CN=alice)
+func parseDistinguishedName(dn string) (pkix.Name, error) {
+	var name pkix.Name
+
+	var parts []string
+	if strings.HasPrefix(dn, "/") {
+		parts = strings.Split(dn[1:], "/")
+	} else {
+		parts = splitQuoted(dn, ',')
+	}
+
+	for _, part := range parts {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return name, fmt.Errorf("invalid distinguished name %q", dn)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		value = strings.NewReplacer(`\,`, ",", `\+`, "+", `\"`, `"`, `\\`, `\`).Replace(value)
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "CN":
+			name.CommonName = value
+		case "O":
+			name.Organization = append(name.Organization, value)
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, value)
+		case "C":
+			name.Country = append(name.Country, value)
+		case "L":
+			name.Locality = append(name.Locality, value)
+		case "ST":
+			name.Province = append(name.Province, value)
+		}
+	}
+
+	if name.CommonName == "" {
+		return name, fmt.Errorf("distinguished name %q has no CN", dn)
+	}
+	return name, nil
+}
+
+// splitQuoted splits s at sep, ignoring separators inside double quotes or
+// escaped with a backslash
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateProxyAuthConfigHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string // empty if the configuration must be rejected
+	}{
+		{"no header", "", ""},
+		{"single header", "X-SSL-Client-S-DN", headerSSLClientSubjectDN},
+		{"header case is normalized", "x-remote-user", headerRemoteUser},
+		{"unsupported header", "X-User", ""},
+		{"header list", "X-SSL-Client-Cert,X-Remote-User", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ProxyAuthConfig{Enabled: true, TrustedProxies: []string{"127.0.0.1"}, Header: tt.header}
+			err := validateProxyAuthConfig(&cfg)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("validateProxyAuthConfig accepted header %q", tt.header)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateProxyAuthConfig failed: %v", err)
+			}
+			if cfg.Header != tt.want {
+				t.Errorf("header = %q, want %q", cfg.Header, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityHeaderRejectsOtherHeaders(t *testing.T) {
+	cfg := ProxyAuthConfig{Enabled: true, TrustedProxies: []string{"127.0.0.1"}, Header: headerSSLClientSubjectDN}
+	if err := validateProxyAuthConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		wantValue string
+		wantErr   bool
+	}{
+		{"configured header", map[string]string{headerSSLClientSubjectDN: "CN=alice"}, "CN=alice", false},
+		{"no header", nil, "", false},
+		{"empty other header", map[string]string{headerSSLClientSubjectDN: "CN=alice", headerRemoteUser: " "}, "CN=alice", false},
+		{"forged forwarded client cert", map[string]string{
+			headerSSLClientSubjectDN:  "CN=alice",
+			headerForwardedClientCert: `Subject="CN=admin"`,
+		}, "", true},
+		{"forged forwarded client cert alone", map[string]string{headerForwardedClientCert: `Subject="CN=admin"`}, "", true},
+		{"forged remote user", map[string]string{headerRemoteUser: "admin"}, "", true},
+		{"forged client cert", map[string]string{headerSSLClientCert: "-----BEGIN"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for header, value := range tt.headers {
+				r.Header.Set(header, value)
+			}
+			value, err := cfg.identityHeader(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("identityHeader accepted %v", tt.headers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("identityHeader failed: %v", err)
+			}
+			if value != tt.wantValue {
+				t.Errorf("identityHeader = %q, want %q", value, tt.wantValue)
+			}
+		})
+	}
+}
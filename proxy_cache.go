@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values of the X-Cache response header of /proxy
+const (
+	cacheMiss   = "MISS"
+	cacheShared = "SHARED"
+	cacheHit    = "HIT"
+)
+
+// ProxyCacheRule caches successful GET responses of paths with the prefix
+type ProxyCacheRule struct {
+	Prefix string        `yaml:"prefix"`
+	TTL    time.Duration `yaml:"ttl"`
+}
+
+// upstreamResponse is a buffered Elasticsearch response shared by coalesced
+// requests and kept in the cache
+type upstreamResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	fetched time.Time
+	latency time.Duration
+}
+
+// upstreamCall is an Elasticsearch request in flight that identical GETs wait for
+type upstreamCall struct {
+	done chan struct{}
+	res  *upstreamResponse
+	err  error
+	// generation is the cache generation the request was started in
+	generation uint64
+	// waiters counts the clients still waiting, the request is cancelled
+	// when the last one goes away. Guarded by the mutex of the cache.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// errUpstreamTooLarge is returned for responses that exceed
+// proxy.cache_max_response_bytes, they are streamed to every client instead
+var errUpstreamTooLarge = errors.New("response exceeds proxy.cache_max_response_bytes")
+
+// cachedResponse is a cache entry valid until expires
+type cachedResponse struct {
+	res     *upstreamResponse
+	expires time.Time
+}
+
+// ProxyCache deduplicates concurrent identical GET requests to Elasticsearch
+// and caches responses of configured paths for a short time
+type ProxyCache struct {
+	mutex   sync.Mutex
+	calls   map[string]*upstreamCall
+	entries map[string]cachedResponse
+	// generation is incremented by Invalidate, responses of requests started
+	// in an earlier generation are not cached
+	generation uint64
+}
+
+var proxyCache = &ProxyCache{
+	calls:   make(map[string]*upstreamCall),
+	entries: make(map[string]cachedResponse),
+}
+
+// validateProxyCacheRules checks the cache rules of the proxy
+func validateProxyCacheRules(pc *ProxyConfig) error {
+	for i, rule := range pc.Cache {
+		if !strings.HasPrefix(rule.Prefix, "/") {
+			return fmt.Errorf("proxy.cache[%d]: prefix must start with /, got %q", i, rule.Prefix)
+		}
+		if rule.TTL <= 0 {
+			return fmt.Errorf("proxy.cache[%d]: ttl must be positive, got %s", i, rule.TTL)
+		}
+	}
+	if pc.CacheMaxEntries <= 0 {
+		return fmt.Errorf("proxy.cache_max_entries must be positive, got %d", pc.CacheMaxEntries)
+	}
+	if pc.CacheMaxResponseBytes <= 0 {
+		return fmt.Errorf("proxy.cache_max_response_bytes must be positive, got %d", pc.CacheMaxResponseBytes)
+	}
+	return nil
+}
+
+// CacheTTLFor returns how long responses of a path are cached, 0 if they are
+// not. The longest matching prefix wins, the query string is ignored.
+func (pc ProxyConfig) CacheTTLFor(path string) time.Duration {
+	path, _, _ = strings.Cut(path, "?")
+	var ttl time.Duration
+	longest := -1
+	for _, rule := range pc.Cache {
+		if strings.HasPrefix(path, rule.Prefix) && len(rule.Prefix) > longest {
+			ttl, longest = rule.TTL, len(rule.Prefix)
+		}
+	}
+	return ttl
+}
+
+// ServeGET answers a GET without body from the cache, by joining an identical
+// request in flight or by asking Elasticsearch at esURL, built from path by
+// upstreamURL. The upstream request is not tied to a single client, it keeps
+// running for the others if one goes away and is cancelled when all of them
+// did. Responses too large to buffer are streamed to every client with a
+// request of its own.
+func (c *ProxyCache) ServeGET(w http.ResponseWriter, r *http.Request, path, esURL string, timeout time.Duration) {
+	proxyConfig := configManager.Get().Proxy
+	ttl := proxyConfig.CacheTTLFor(path)
+	entry := accessLogFromContext(r.Context())
+
+	c.mutex.Lock()
+	if cached, ok := c.entries[path]; ok && time.Now().Before(cached.expires) {
+		c.mutex.Unlock()
+		if entry != nil {
+			entry.Cache = cacheHit
+		}
+		writeUpstreamResponse(w, cached.res, cacheHit)
+		return
+	}
+	call, shared := c.calls[path]
+	if !shared {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+		call = &upstreamCall{done: make(chan struct{}), generation: c.generation, cancel: cancel}
+		c.calls[path] = call
+		go c.fetch(ctx, call, path, esURL, ttl, proxyConfig.CacheMaxEntries, proxyConfig.CacheMaxResponseBytes)
+	}
+	call.waiters++
+	c.mutex.Unlock()
+
+	select {
+	case <-call.done:
+	case <-r.Context().Done():
+		c.leave(path, call)
+		writeUpstreamError(w, r, r.Context().Err(), timeout)
+		return
+	}
+
+	state := cacheMiss
+	if shared {
+		state = cacheShared
+	}
+	if entry != nil {
+		entry.Cache = state
+		if call.res != nil {
+			entry.UpstreamStatus = call.res.status
+			entry.UpstreamLatency = call.res.latency
+		}
+	}
+	if errors.Is(call.err, errUpstreamTooLarge) {
+		slog.Debug("Streaming Elasticsearch response too large to buffer", "es_path", path)
+		if entry != nil {
+			entry.Cache = cacheMiss
+		}
+		streamUpstream(w, r, path, esURL, timeout)
+		return
+	}
+	if call.err != nil {
+		writeUpstreamError(w, r, call.err, timeout)
+		return
+	}
+	writeUpstreamResponse(w, call.res, state)
+}
+
+// leave removes a client that went away from the waiters of call and cancels
+// the upstream request if it was the last one. Later GETs do not join the
+// cancelled request.
+func (c *ProxyCache) leave(path string, call *upstreamCall) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	if c.calls[path] == call {
+		delete(c.calls, path)
+	}
+	call.cancel()
+}
+
+// fetch requests esURL with ctx for all requests waiting on call and caches a
+// successful response under path if ttl is positive and the cache was not
+// invalidated in the meantime
+func (c *ProxyCache) fetch(ctx context.Context, call *upstreamCall, path, esURL string, ttl time.Duration, maxEntries int, maxBytes int64) {
+	defer call.cancel()
+
+	call.res, call.err = fetchUpstream(ctx, esURL, maxBytes)
+
+	c.mutex.Lock()
+	if c.calls[path] == call {
+		delete(c.calls, path)
+	}
+	if call.err == nil && ttl > 0 && call.res.status >= 200 && call.res.status < 300 && call.generation == c.generation {
+		c.evict(maxEntries)
+		c.entries[path] = cachedResponse{res: call.res, expires: call.res.fetched.Add(ttl)}
+	}
+	c.mutex.Unlock()
+	close(call.done)
+}
+
+// evict removes expired entries and, if the cache is still full, the oldest
+// ones. The caller must hold the mutex.
+func (c *ProxyCache) evict(maxEntries int) {
+	now := time.Now()
+	for key, cached := range c.entries {
+		if now.After(cached.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) >= maxEntries {
+		oldest := ""
+		for key, cached := range c.entries {
+			if oldest == "" || cached.res.fetched.Before(c.entries[oldest].res.fetched) {
+				oldest = key
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
+
+// Invalidate drops all cached responses. Writes through the proxy call it, so
+// e.g. a changed cluster setting is visible right away. Requests in flight
+// may have been answered before the write, later GETs do not join them and
+// their responses are not cached.
+func (c *ProxyCache) Invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	clear(c.calls)
+	if len(c.entries) > 0 {
+		slog.Debug("Dropping cached Elasticsearch responses", "entries", len(c.entries))
+		clear(c.entries)
+	}
+}
+
+// fetchUpstream sends a GET request to Elasticsearch and buffers the response,
+// failing with errUpstreamTooLarge if the body exceeds maxBytes
+func fetchUpstream(ctx context.Context, esURL string, maxBytes int64) (*upstreamResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, esURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.ContentLength > maxBytes {
+		return nil, errUpstreamTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, errUpstreamTooLarge
+	}
+	return &upstreamResponse{
+		status:  res.StatusCode,
+		header:  res.Header.Clone(),
+		body:    body,
+		fetched: time.Now(),
+		latency: time.Since(start),
+	}, nil
+}
+
+// streamUpstream sends a GET request to Elasticsearch for a single client and
+// copies the response without buffering it
+func streamUpstream(w http.ResponseWriter, r *http.Request, path, esURL string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, esURL, nil)
+	if err != nil {
+		writeUpstreamError(w, r, err, timeout)
+		return
+	}
+
+	entry := accessLogFromContext(r.Context())
+	start := time.Now()
+	res, err := http.DefaultClient.Do(req)
+	if entry != nil {
+		entry.UpstreamLatency = time.Since(start)
+		if err == nil {
+			entry.UpstreamStatus = res.StatusCode
+		}
+	}
+	if err != nil {
+		writeUpstreamError(w, r, err, timeout)
+		return
+	}
+	defer res.Body.Close()
+
+	maps.Copy(w.Header(), res.Header)
+	w.Header().Set("X-Cache", cacheMiss)
+	w.WriteHeader(res.StatusCode)
+	if _, err := io.Copy(w, res.Body); err != nil && ctx.Err() == context.DeadlineExceeded {
+		slog.Warn("Elasticsearch response cut off by the proxy timeout", "es_path", path, "timeout", timeout)
+	}
+}
+
+// writeUpstreamResponse sends a buffered Elasticsearch response with headers
+// telling whether it came from the cache and how old it is
+func writeUpstreamResponse(w http.ResponseWriter, res *upstreamResponse, state string) {
+	maps.Copy(w.Header(), res.header.Clone())
+	w.Header().Set("X-Cache", state)
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(res.fetched).Seconds())))
+	w.Header().Set("Content-Length", strconv.Itoa(len(res.body)))
+	w.WriteHeader(res.status)
+	w.Write(res.body)
+}
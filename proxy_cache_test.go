@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useTestProxyConfig makes the proxy configuration active for the test
+func useTestProxyConfig(t *testing.T, proxy ProxyConfig) {
+	t.Helper()
+	previous := configManager
+	t.Cleanup(func() { configManager = previous })
+	configManager = &ConfigManager{}
+	configManager.current.Store(&Config{Proxy: proxy})
+}
+
+// serveGET runs a GET through the cache and returns the response
+func serveGET(c *ProxyCache, path, esURL string) *httptest.ResponseRecorder {
+	return serveGETContext(context.Background(), c, path, esURL)
+}
+
+// serveGETContext runs a GET of a client that goes away when ctx is cancelled
+func serveGETContext(ctx context.Context, c *ProxyCache, path, esURL string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c.ServeGET(rec, httptest.NewRequestWithContext(ctx, "POST", "/proxy", nil), path, esURL, 5*time.Second)
+	return rec
+}
+
+func TestProxyCacheInvalidateDuringFetch(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			close(started)
+			<-release
+			fmt.Fprint(w, "before write")
+			return
+		}
+		fmt.Fprint(w, "after write")
+	}))
+	defer upstream.Close()
+
+	proxy := defaultProxyConfig()
+	proxy.Cache = []ProxyCacheRule{{Prefix: "/_cluster/health", TTL: time.Minute}}
+	useTestProxyConfig(t, proxy)
+	c := &ProxyCache{calls: make(map[string]*upstreamCall), entries: make(map[string]cachedResponse)}
+	path, esURL := "/_cluster/health", upstream.URL+"/_cluster/health"
+
+	// A GET is in flight when a write invalidates the cache
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() { inFlight <- serveGET(c, path, esURL) }()
+	<-started
+	c.Invalidate()
+
+	// Later GETs must not join it
+	if rec := serveGET(c, path, esURL); rec.Body.String() != "after write" || rec.Header().Get("X-Cache") != cacheMiss {
+		t.Errorf("GET after the write = %q (%s), want a new request", rec.Body, rec.Header().Get("X-Cache"))
+	}
+
+	close(release)
+	if rec := <-inFlight; rec.Body.String() != "before write" {
+		t.Errorf("GET in flight = %q", rec.Body)
+	}
+
+	// and its stale response must not replace the fresh one in the cache
+	if rec := serveGET(c, path, esURL); rec.Body.String() != "after write" || rec.Header().Get("X-Cache") != cacheHit {
+		t.Errorf("cached GET = %q (%s), want the response fetched after the write", rec.Body, rec.Header().Get("X-Cache"))
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Elasticsearch got %d requests, want 2", n)
+	}
+}
+
+func TestProxyCacheLargeResponse(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+
+	tests := []struct {
+		name    string
+		chunked bool
+	}{
+		{"with content length", false},
+		{"chunked", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				if !tt.chunked {
+					w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+					fmt.Fprint(w, body)
+					return
+				}
+				for i := 0; i < len(body); i += 100 {
+					fmt.Fprint(w, body[i:i+100])
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer upstream.Close()
+
+			proxy := defaultProxyConfig()
+			proxy.Cache = []ProxyCacheRule{{Prefix: "/_cat/shards", TTL: time.Minute}}
+			proxy.CacheMaxResponseBytes = 500
+			useTestProxyConfig(t, proxy)
+			c := &ProxyCache{calls: make(map[string]*upstreamCall), entries: make(map[string]cachedResponse)}
+
+			for range 2 {
+				rec := serveGET(c, "/_cat/shards", upstream.URL+"/_cat/shards")
+				if rec.Code != http.StatusOK || rec.Body.String() != body {
+					t.Fatalf("GET returned %d with %d bytes, want the full response", rec.Code, rec.Body.Len())
+				}
+				if state := rec.Header().Get("X-Cache"); state != cacheMiss {
+					t.Errorf("X-Cache = %s, want %s", state, cacheMiss)
+				}
+			}
+			if len(c.entries) != 0 {
+				t.Errorf("response larger than proxy.cache_max_response_bytes was cached")
+			}
+		})
+	}
+}
+
+func TestProxyCacheCancelsAbandonedFetch(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	useTestProxyConfig(t, defaultProxyConfig())
+	c := &ProxyCache{calls: make(map[string]*upstreamCall), entries: make(map[string]cachedResponse)}
+	path, esURL := "/_cat/shards", upstream.URL+"/_cat/shards"
+
+	waiters := func() int {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if call, ok := c.calls[path]; ok {
+			return call.waiters
+		}
+		return 0
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	results := make(chan *httptest.ResponseRecorder, 2)
+	go func() { results <- serveGETContext(first, c, path, esURL) }()
+	<-started
+	go func() { results <- serveGETContext(second, c, path, esURL) }()
+	for waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The request keeps running while a client still waits for it
+	cancelFirst()
+	<-results
+	select {
+	case <-cancelled:
+		t.Fatal("upstream request cancelled while a client still waits")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancelSecond()
+	<-results
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream request still running after all clients went away")
+	}
+	if waiters() != 0 {
+		t.Error("later GETs would join the cancelled request")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// statusClientClosedRequest is logged when the client went away before
+// Elasticsearch answered, as nginx does
+const statusClientClosedRequest = 499
+
+// ProxyConfig holds the upstream deadlines and size limits of /proxy
+type ProxyConfig struct {
+	// Timeout is the deadline of a proxied request including the response body
+	Timeout time.Duration `yaml:"timeout"`
+	// PathTimeouts override Timeout for paths with the longest matching prefix
+	PathTimeouts    []ProxyPathTimeout `yaml:"path_timeouts"`
+	MaxRequestBytes int64              `yaml:"max_request_bytes"`
+	MaxBodyBytes    int64              `yaml:"max_body_bytes"`
+	// Cache keeps successful GET responses of the matching paths for a short time
+	Cache           []ProxyCacheRule `yaml:"cache"`
+	CacheMaxEntries int              `yaml:"cache_max_entries"`
+	// CacheMaxResponseBytes limits the responses buffered for coalesced GETs
+	// and the cache, larger ones are streamed to each client
+	CacheMaxResponseBytes int64           `yaml:"cache_max_response_bytes"`
+	RateLimit             RateLimitConfig `yaml:"rate_limit"`
+}
+
+// ProxyPathTimeout sets the deadline for a class of Elasticsearch paths
+type ProxyPathTimeout struct {
+	Prefix  string        `yaml:"prefix"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// defaultProxyConfig returns the proxy defaults. _cat/shards lists every shard
+// and is slow on big clusters.
+func defaultProxyConfig() ProxyConfig {
+	return ProxyConfig{
+		Timeout: 30 * time.Second,
+		PathTimeouts: []ProxyPathTimeout{
+			{Prefix: "/_cat/shards", Timeout: 2 * time.Minute},
+		},
+		MaxRequestBytes:       2 << 20,
+		MaxBodyBytes:          1 << 20,
+		CacheMaxEntries:       100,
+		CacheMaxResponseBytes: 8 << 20,
+		RateLimit: RateLimitConfig{
+			PerIdentity: LimitConfig{Rate: 20, Burst: 40, MaxConcurrent: 30},
+		},
+	}
+}
+
+// validateProxyConfig checks the deadlines and limits of the proxy
+func validateProxyConfig(cfg *Config) error {
+	pc := &cfg.Proxy
+	if pc.Timeout <= 0 {
+		return fmt.Errorf("proxy.timeout must be positive, got %s", pc.Timeout)
+	}
+	for i, pt := range pc.PathTimeouts {
+		if !strings.HasPrefix(pt.Prefix, "/") {
+			return fmt.Errorf("proxy.path_timeouts[%d]: prefix must start with /, got %q", i, pt.Prefix)
+		}
+		if pt.Timeout <= 0 {
+			return fmt.Errorf("proxy.path_timeouts[%d]: timeout must be positive, got %s", i, pt.Timeout)
+		}
+	}
+	if pc.MaxRequestBytes <= 0 || pc.MaxBodyBytes <= 0 {
+		return fmt.Errorf("proxy.max_request_bytes and proxy.max_body_bytes must be positive")
+	}
+	if err := validateProxyCacheRules(pc); err != nil {
+		return err
+	}
+	if err := validateRateLimitConfig(&pc.RateLimit); err != nil {
+		return err
+	}
+
+	// The server cuts off responses after its write timeout
+	if cfg.Server.WriteTimeout > 0 {
+		for _, timeout := range append([]time.Duration{pc.Timeout}, pathTimeouts(pc.PathTimeouts)...) {
+			if timeout > cfg.Server.WriteTimeout {
+				slog.Warn("Proxy timeout exceeds server.write_timeout, responses are cut off earlier",
+					"timeout", timeout, "write_timeout", cfg.Server.WriteTimeout)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// pathTimeouts returns the timeouts of the path classes
+func pathTimeouts(classes []ProxyPathTimeout) []time.Duration {
+	timeouts := make([]time.Duration, 0, len(classes))
+	for _, pt := range classes {
+		timeouts = append(timeouts, pt.Timeout)
+	}
+	return timeouts
+}
+
+// TimeoutFor returns the deadline of a proxied path, ignoring its query string
+func (pc ProxyConfig) TimeoutFor(path string) time.Duration {
+	path, _, _ = strings.Cut(path, "?")
+	timeout, longest := pc.Timeout, -1
+	for _, pt := range pc.PathTimeouts {
+		if strings.HasPrefix(path, pt.Prefix) && len(pt.Prefix) > longest {
+			timeout, longest = pt.Timeout, len(pt.Prefix)
+		}
+	}
+	return timeout
+}
+
+// elasticsearchBase is elasticsearchURL parsed, upstream URLs are built from it
+var elasticsearchBase = func() *url.URL {
+	u, err := url.Parse(elasticsearchURL)
+	if err != nil {
+		panic(fmt.Sprintf("invalid elasticsearchURL %q: %v", elasticsearchURL, err))
+	}
+	return u
+}()
+
+// upstreamURL builds the Elasticsearch URL of a path sent by the browser. The
+// path is untrusted: concatenated to the base URL, "@host/x" or "//host/x"
+// would redirect the request to another server. Only absolute paths without
+// scheme, host, fragment or dot segments are accepted, the query string is
+// kept as is. The decoded path is returned as well: Elasticsearch decodes
+// /_cluster/%73ettings to /_cluster/settings, so checks of the path must
+// look at the decoded form.
+func upstreamURL(path string) (esURL, decodedPath string, err error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("path must start with /")
+	}
+	if strings.HasPrefix(path, "//") {
+		return "", "", fmt.Errorf("path must not start with //")
+	}
+	if strings.Contains(path, "#") {
+		return "", "", fmt.Errorf("path must not contain a fragment")
+	}
+	// Some servers treat \ like /, the query string may need it for Lucene escapes
+	if rawPath, _, _ := strings.Cut(path, "?"); strings.Contains(rawPath, "\\") {
+		return "", "", fmt.Errorf("path must not contain \\")
+	}
+
+	// url.Parse also rejects control characters
+	ref, parseErr := url.Parse(path)
+	if parseErr != nil {
+		return "", "", fmt.Errorf("invalid path: %v", parseErr)
+	}
+	if ref.Scheme != "" || ref.Host != "" || ref.User != nil || ref.Opaque != "" {
+		return "", "", fmt.Errorf("path must not contain a scheme or host")
+	}
+	// Check the decoded path too, so %2e%2e cannot sneak past
+	for _, segment := range strings.Split(ref.Path, "/") {
+		if segment == ".." || segment == "." {
+			return "", "", fmt.Errorf("path must not contain . or .. segments")
+		}
+	}
+
+	u := *elasticsearchBase
+	u.Path = strings.TrimSuffix(elasticsearchBase.Path, "/") + ref.Path
+	if ref.RawPath != "" {
+		u.RawPath = strings.TrimSuffix(elasticsearchBase.EscapedPath(), "/") + ref.RawPath
+	}
+	u.RawQuery = ref.RawQuery
+	return u.String(), ref.Path, nil
+}
+
+// ProxyError is the JSON body of errors returned by /proxy
+type ProxyError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+// writeProxyError sends a structured JSON error
+func writeProxyError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ProxyError{Error: code, Message: message, Status: status})
+}
+
+// writeUpstreamError reports a failed Elasticsearch request, telling a
+// deadline apart from a refused or otherwise failed connection
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, err error, timeout time.Duration) {
+	var netErr net.Error
+	switch {
+	case r.Context().Err() == context.Canceled:
+		slog.Debug("Client closed the request before Elasticsearch answered", "remote", r.RemoteAddr)
+		w.WriteHeader(statusClientClosedRequest)
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		writeProxyError(w, http.StatusGatewayTimeout, "upstream_timeout",
+			fmt.Sprintf("Elasticsearch did not answer within %s", timeout))
+	case errors.Is(err, syscall.ECONNREFUSED):
+		writeProxyError(w, http.StatusBadGateway, "upstream_connection_refused",
+			"Elasticsearch refused the connection: "+err.Error())
+	default:
+		writeProxyError(w, http.StatusBadGateway, "upstream_unavailable",
+			"Failed to fetch from Elasticsearch: "+err.Error())
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestUpstreamURL(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string // empty if the path must be rejected
+	}{
+		{"plain path", "/_cluster/health", "http://localhost:9200/_cluster/health"},
+		{"root", "/", "http://localhost:9200/"},
+		{"query string", "/_cat/indices?v&h=index,health", "http://localhost:9200/_cat/indices?v&h=index,health"},
+		{"query with at sign and escape", `/_search?q=user:a@b\:c`, `http://localhost:9200/_search?q=user:a@b\:c`},
+		{"query with encoded characters", "/_search?q=a%20b&x=%2F..%2F", "http://localhost:9200/_search?q=a%20b&x=%2F..%2F"},
+		{"query with dot segments", "/_search?path=../../etc", "http://localhost:9200/_search?path=../../etc"},
+		{"encoded slash in index name", "/my%2Findex/_search", "http://localhost:9200/my%2Findex/_search"},
+		{"colon in path", "/_cat/indices/logs-*:foo", "http://localhost:9200/_cat/indices/logs-*:foo"},
+		{"at sign in path", "/logs@2024/_search", "http://localhost:9200/logs@2024/_search"},
+
+		{"userinfo host", "@attacker.internal:80/x", ""},
+		{"userinfo host with slash", "/@attacker.internal:80/x", "http://localhost:9200/@attacker.internal:80/x"},
+		{"protocol relative", "//attacker.internal/x", ""},
+		{"protocol relative with triple slash", "///attacker.internal/x", ""},
+		{"backslash host", `/\attacker.internal/x`, ""},
+		{"backslash in path", `/_cat\..\x`, ""},
+		{"no leading slash", "_cluster/health", ""},
+		{"empty", "", ""},
+		{"http scheme", "http://attacker.internal/x", ""},
+		{"javascript scheme", "javascript:alert(1)", ""},
+		{"file scheme", "file:///etc/passwd", ""},
+		{"dot dot", "/../x", ""},
+		{"dot dot in the middle", "/_cat/../_cluster/settings", ""},
+		{"trailing dot dot", "/_cat/..", ""},
+		{"single dot", "/./x", ""},
+		{"encoded dot dot", "/%2e%2e/x", ""},
+		{"encoded dot dot upper case", "/%2E%2E/x", ""},
+		{"mixed encoded dot dot", "/.%2e/x", ""},
+		{"dot dot with encoded slash", "/a/..%2f..%2fx", ""},
+		{"encoded dot dot and slash", "/%2e%2e%2fx", ""},
+		{"fragment", "/_cat/indices#frag", ""},
+		{"fragment in query", "/_search?q=a#frag", ""},
+		{"newline", "/_cat/indices\nX-Injected: 1", ""},
+		{"carriage return", "/_cat/indices\r\n", ""},
+		{"null byte", "/_cat/indices\x00", ""},
+		{"tab", "/_cat\tindices", ""},
+		{"delete character", "/_cat/indices\x7f", ""},
+		{"control character in query", "/_search?q=a\x01", ""},
+		{"invalid escape", "/_cat/%zz", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := upstreamURL(tt.path)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("upstreamURL(%q) = %q, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("upstreamURL(%q) failed: %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("upstreamURL(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+
+			// Whatever the path, the request must go to Elasticsearch
+			u, err := url.Parse(got)
+			if err != nil {
+				t.Fatalf("upstreamURL(%q) returned an invalid URL %q: %v", tt.path, got, err)
+			}
+			if u.Scheme != elasticsearchBase.Scheme || u.Host != elasticsearchBase.Host || u.User != nil {
+				t.Errorf("upstreamURL(%q) = %q leaves %s", tt.path, got, elasticsearchURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig holds the rate limits of /proxy per identity and globally
+type RateLimitConfig struct {
+	PerIdentity LimitConfig `yaml:"per_identity"`
+	Global      LimitConfig `yaml:"global"`
+}
+
+// LimitConfig is a token bucket refilled with Rate requests per second up to
+// Burst, together with a cap of concurrent upstream requests. Zero disables a limit.
+type LimitConfig struct {
+	Rate          float64 `yaml:"rate"`
+	Burst         int     `yaml:"burst"`
+	MaxConcurrent int     `yaml:"max_concurrent"`
+}
+
+// validateRateLimitConfig checks the limits and defaults the burst to the rate
+func validateRateLimitConfig(rl *RateLimitConfig) error {
+	limits := []struct {
+		name  string
+		limit *LimitConfig
+	}{{"per_identity", &rl.PerIdentity}, {"global", &rl.Global}}
+	for _, l := range limits {
+		limit := l.limit
+		if limit.Rate < 0 || limit.Burst < 0 || limit.MaxConcurrent < 0 {
+			return fmt.Errorf("proxy.rate_limit.%s: rate, burst and max_concurrent must not be negative", l.name)
+		}
+		if limit.Rate > 0 && limit.Burst == 0 {
+			limit.Burst = max(1, int(math.Ceil(limit.Rate)))
+		}
+	}
+	return nil
+}
+
+// tokenBucket holds the tokens and requests in flight of one identity or of all
+type tokenBucket struct {
+	tokens   float64
+	last     time.Time
+	inflight int
+	rejected uint64
+	warned   time.Time
+}
+
+// refill adds the tokens accumulated since the last call
+func (b *tokenBucket) refill(limit LimitConfig, now time.Time) {
+	if b.last.IsZero() {
+		b.tokens = float64(limit.Burst)
+	} else {
+		b.tokens = min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	}
+	b.last = now
+}
+
+// wait returns how long until a token is available, 0 if one is available now
+func (b *tokenBucket) wait(limit LimitConfig) time.Duration {
+	if limit.Rate <= 0 || b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// RateLimiter enforces the rate and concurrency limits of /proxy
+type RateLimiter struct {
+	mutex      sync.Mutex
+	global     tokenBucket
+	identities map[string]*tokenBucket
+	swept      time.Time
+
+	rateLimited        map[string]uint64
+	concurrencyLimited map[string]uint64
+}
+
+var rateLimiter = &RateLimiter{
+	identities:         make(map[string]*tokenBucket),
+	rateLimited:        make(map[string]uint64),
+	concurrencyLimited: make(map[string]uint64),
+}
+
+// limitRejection describes why a request was rejected
+type limitRejection struct {
+	scope      string
+	reason     string
+	retryAfter time.Duration
+}
+
+// Acquire takes a token and an upstream slot for the identity and globally.
+// On success the returned release function must be called once the upstream
+// request finished.
+func (rl *RateLimiter) Acquire(identity string, config RateLimitConfig) (func(), *limitRejection) {
+	now := time.Now()
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.sweep(now, config)
+	bucket, ok := rl.identities[identity]
+	if !ok {
+		bucket = &tokenBucket{}
+		rl.identities[identity] = bucket
+	}
+	bucket.refill(config.PerIdentity, now)
+	rl.global.refill(config.Global, now)
+
+	var rejection *limitRejection
+	switch {
+	case bucket.wait(config.PerIdentity) > 0:
+		rejection = &limitRejection{"identity", "rate", bucket.wait(config.PerIdentity)}
+	case rl.global.wait(config.Global) > 0:
+		rejection = &limitRejection{"global", "rate", rl.global.wait(config.Global)}
+	case config.PerIdentity.MaxConcurrent > 0 && bucket.inflight >= config.PerIdentity.MaxConcurrent:
+		rejection = &limitRejection{"identity", "concurrency", time.Second}
+	case config.Global.MaxConcurrent > 0 && rl.global.inflight >= config.Global.MaxConcurrent:
+		rejection = &limitRejection{"global", "concurrency", time.Second}
+	}
+	if rejection != nil {
+		rl.reject(identity, bucket, rejection, now)
+		return nil, rejection
+	}
+
+	if config.PerIdentity.Rate > 0 {
+		bucket.tokens--
+	}
+	if config.Global.Rate > 0 {
+		rl.global.tokens--
+	}
+	bucket.inflight++
+	rl.global.inflight++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			rl.mutex.Lock()
+			defer rl.mutex.Unlock()
+			bucket.inflight--
+			rl.global.inflight--
+		})
+	}, nil
+}
+
+// reject counts a rejected request and logs the limiter state at most once a
+// minute per identity. The caller must hold the mutex.
+func (rl *RateLimiter) reject(identity string, bucket *tokenBucket, rejection *limitRejection, now time.Time) {
+	bucket.rejected++
+	if rejection.reason == "rate" {
+		rl.rateLimited[rejection.scope]++
+	} else {
+		rl.concurrencyLimited[rejection.scope]++
+	}
+	if now.Sub(bucket.warned) < time.Minute {
+		return
+	}
+	bucket.warned = now
+	slog.Warn("Proxy request limit exceeded", "identity", identity, "scope", rejection.scope, "limit", rejection.reason,
+		"tokens", math.Floor(bucket.tokens*100)/100, "inflight", bucket.inflight,
+		"global_tokens", math.Floor(rl.global.tokens*100)/100, "global_inflight", rl.global.inflight,
+		"rejected_total", bucket.rejected, "retry_after", rejection.retryAfter.Round(time.Millisecond))
+}
+
+// sweep forgets identities that are idle and have a full bucket, at most once
+// a minute. The caller must hold the mutex.
+func (rl *RateLimiter) sweep(now time.Time, config RateLimitConfig) {
+	if now.Sub(rl.swept) < time.Minute {
+		return
+	}
+	rl.swept = now
+	for identity, bucket := range rl.identities {
+		bucket.refill(config.PerIdentity, now)
+		if bucket.inflight == 0 && bucket.tokens >= float64(config.PerIdentity.Burst) {
+			delete(rl.identities, identity)
+		}
+	}
+}
+
+// writeMetrics writes the limiter state in the Prometheus text format
+func (rl *RateLimiter) writeMetrics(w http.ResponseWriter, config RateLimitConfig) {
+	now := time.Now()
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.global.refill(config.Global, now)
+	fmt.Fprintln(w, "# HELP board_proxy_rejected_total Requests to /proxy rejected by a limit.")
+	fmt.Fprintln(w, "# TYPE board_proxy_rejected_total counter")
+	for _, scope := range []string{"global", "identity"} {
+		fmt.Fprintf(w, "board_proxy_rejected_total{scope=%q,limit=\"rate\"} %d\n", scope, rl.rateLimited[scope])
+		fmt.Fprintf(w, "board_proxy_rejected_total{scope=%q,limit=\"concurrency\"} %d\n", scope, rl.concurrencyLimited[scope])
+	}
+	fmt.Fprintln(w, "# HELP board_proxy_inflight Upstream requests to Elasticsearch in flight.")
+	fmt.Fprintln(w, "# TYPE board_proxy_inflight gauge")
+	fmt.Fprintf(w, "board_proxy_inflight %d\n", rl.global.inflight)
+	if config.Global.Rate > 0 {
+		fmt.Fprintln(w, "# HELP board_proxy_tokens Tokens left in the global rate limit bucket.")
+		fmt.Fprintln(w, "# TYPE board_proxy_tokens gauge")
+		fmt.Fprintf(w, "board_proxy_tokens %g\n", math.Floor(rl.global.tokens*100)/100)
+	}
+
+	identities := slices.Sorted(maps.Keys(rl.identities))
+	fmt.Fprintln(w, "# HELP board_proxy_identity_inflight Upstream requests in flight per identity.")
+	fmt.Fprintln(w, "# TYPE board_proxy_identity_inflight gauge")
+	for _, identity := range identities {
+		fmt.Fprintf(w, "board_proxy_identity_inflight{identity=%q} %d\n", identity, rl.identities[identity].inflight)
+	}
+	fmt.Fprintln(w, "# HELP board_proxy_identity_rejected_total Requests to /proxy rejected per identity.")
+	fmt.Fprintln(w, "# TYPE board_proxy_identity_rejected_total counter")
+	for _, identity := range identities {
+		fmt.Fprintf(w, "board_proxy_identity_rejected_total{identity=%q} %d\n", identity, rl.identities[identity].rejected)
+	}
+	if config.PerIdentity.Rate > 0 {
+		fmt.Fprintln(w, "# HELP board_proxy_identity_tokens Tokens left in the rate limit bucket per identity.")
+		fmt.Fprintln(w, "# TYPE board_proxy_identity_tokens gauge")
+		for _, identity := range identities {
+			bucket := rl.identities[identity]
+			bucket.refill(config.PerIdentity, now)
+			fmt.Fprintf(w, "board_proxy_identity_tokens{identity=%q} %g\n", identity, math.Floor(bucket.tokens*100)/100)
+		}
+	}
+}
+
+// rateLimitKey returns the identity a request is limited as: the
+// authenticated user or, without authentication, the remote address, so
+// anonymous users do not share one bucket
+func rateLimitKey(r *http.Request) string {
+	if id, ok := identityFromContext(r.Context()); ok {
+		return id.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "remote:" + host
+}
+
+// rateLimitMiddleware rejects requests with 429 and Retry-After when the
+// identity or all clients together exceed their limits
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, rejection := rateLimiter.Acquire(rateLimitKey(r), configManager.Get().Proxy.RateLimit)
+		if rejection != nil {
+			retryAfter := int(math.Ceil(rejection.retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, retryAfter)))
+			code, message := "rate_limited", "Too many requests"
+			if rejection.reason == "concurrency" {
+				code, message = "too_many_concurrent_requests", "Too many concurrent requests"
+			}
+			if rejection.scope == "global" {
+				message += " from all clients"
+			}
+			writeProxyError(w, http.StatusTooManyRequests, code, message+", retry later")
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricsHandler exposes the limiter state in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	rateLimiter.writeMetrics(w, configManager.Get().Proxy.RateLimit)
+}
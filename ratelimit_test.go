@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		remote   string
+		identity *Identity
+		want     string
+	}{
+		{"authenticated", "10.0.0.5:4711", &Identity{Name: "alice", Access: accessAdmin}, "alice"},
+		{"anonymous IPv4", "10.0.0.5:4711", nil, "remote:10.0.0.5"},
+		{"anonymous IPv6", "[2001:db8::1]:4711", nil, "remote:2001:db8::1"},
+		{"no port", "10.0.0.5", nil, "remote:10.0.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/proxy", nil)
+			r.RemoteAddr = tt.remote
+			if tt.identity != nil {
+				r = withIdentity(r, *tt.identity)
+			}
+			if got := rateLimitKey(r); got != tt.want {
+				t.Errorf("rateLimitKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterDefaultsAllowDashboards(t *testing.T) {
+	rl := &RateLimiter{
+		identities:         make(map[string]*tokenBucket),
+		rateLimited:        make(map[string]uint64),
+		concurrencyLimited: make(map[string]uint64),
+	}
+	config := defaultProxyConfig().RateLimit
+
+	// Two anonymous users each load a dashboard tab with about ten requests
+	// in flight, neither is limited by the other
+	for _, remote := range []string{"remote:10.0.0.5", "remote:10.0.0.6"} {
+		for i := range 12 {
+			if _, rejection := rl.Acquire(remote, config); rejection != nil {
+				t.Fatalf("request %d of %s rejected: %+v", i+1, remote, rejection)
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPConfig holds the configuration for OCSP checks of client certificates
+type OCSPConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	ResponderURL string        `yaml:"responder_url"`
+	CacheTTL     time.Duration `yaml:"cache_ttl"`
+	Timeout      time.Duration `yaml:"timeout"`
+	FailOpen     bool          `yaml:"fail_open"`
+}
+
+// ocspCacheEntry is a cached OCSP answer for one certificate
+type ocspCacheEntry struct {
+	status    int
+	revokedAt time.Time
+	expires   time.Time
+}
+
+// OCSPChecker queries OCSP responders for client certificates and caches the answers
+type OCSPChecker struct {
+	config OCSPConfig
+	client *http.Client
+	cache  map[string]ocspCacheEntry
+	mutex  sync.Mutex
+}
+
+var ocspChecker *OCSPChecker
+
+// NewOCSPChecker creates an OCSP checker with response caching
+func NewOCSPChecker(config OCSPConfig) *OCSPChecker {
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = time.Hour
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	return &OCSPChecker{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		cache:  make(map[string]ocspCacheEntry),
+	}
+}
+
+// Check returns an error if the certificate is revoked or, unless fail_open is
+// set, if its status cannot be determined
+func (oc *OCSPChecker) Check(cert, issuer *x509.Certificate) error {
+	key := revocationKey(cert.RawIssuer, cert.SerialNumber.String())
+
+	oc.mutex.Lock()
+	entry, ok := oc.cache[key]
+	oc.mutex.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		var err error
+		entry, err = oc.query(cert, issuer)
+		if err != nil {
+			if oc.config.FailOpen {
+				slog.Warn("OCSP check for client certificate failed, allowing (fail_open)",
+					"cn", cert.Subject.CommonName, "serial", cert.SerialNumber.String(), "error", err)
+				return nil
+			}
+			return fmt.Errorf("OCSP check failed: %v", err)
+		}
+
+		oc.mutex.Lock()
+		oc.cache[key] = entry
+		oc.mutex.Unlock()
+	} else {
+		slog.Debug("Using cached OCSP status for client certificate", "cn", cert.Subject.CommonName, "serial", cert.SerialNumber.String())
+	}
+
+	switch entry.status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("revoked at %s according to OCSP", entry.revokedAt.Format(time.RFC3339))
+	default:
+		if oc.config.FailOpen {
+			return nil
+		}
+		return fmt.Errorf("OCSP status unknown")
+	}
+}
+
+// query asks the OCSP responder for the status of a certificate
+func (oc *OCSPChecker) query(cert, issuer *x509.Certificate) (ocspCacheEntry, error) {
+	responderURL := oc.config.ResponderURL
+	if responderURL == "" {
+		if len(cert.OCSPServer) == 0 {
+			return ocspCacheEntry{}, fmt.Errorf("certificate has no OCSP responder and none is configured")
+		}
+		responderURL = cert.OCSPServer[0]
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return ocspCacheEntry{}, fmt.Errorf("failed to create OCSP request: %v", err)
+	}
+
+	res, err := oc.client.Post(responderURL, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return ocspCacheEntry{}, fmt.Errorf("failed to contact OCSP responder %s: %v", responderURL, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return ocspCacheEntry{}, fmt.Errorf("OCSP responder %s returned HTTP %d", responderURL, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1024*1024))
+	if err != nil {
+		return ocspCacheEntry{}, fmt.Errorf("failed to read OCSP response: %v", err)
+	}
+
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return ocspCacheEntry{}, fmt.Errorf("invalid OCSP response: %v", err)
+	}
+
+	// Cache until the responder's next update, but never longer than the configured TTL
+	expires := time.Now().Add(oc.config.CacheTTL)
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(expires) {
+		expires = resp.NextUpdate
+	}
+
+	return ocspCacheEntry{
+		status:    resp.Status,
+		revokedAt: resp.RevokedAt,
+		expires:   expires,
+	}, nil
+}
+
+// revocationKey identifies a certificate by issuer and serial number
+func revocationKey(rawIssuer []byte, serial string) string {
+	return string(rawIssuer) + "/" + serial
+}
+
+// parseCertificates parses all PEM encoded certificates in data
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// loadCRLs reads PEM or DER encoded CRLs, verifies them against the CA
+// certificates and returns the set of revoked certificates
+func loadCRLs(files []string, caCerts []*x509.Certificate) (map[string]time.Time, error) {
+	revoked := make(map[string]time.Time)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CRL file %s: %v", file, err)
+		}
+
+		// Accept PEM files with one or more CRLs as well as a single DER CRL
+		var ders [][]byte
+		for rest := data; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type == "X509 CRL" {
+				ders = append(ders, block.Bytes)
+			}
+		}
+		if len(ders) == 0 {
+			ders = append(ders, data)
+		}
+
+		for _, der := range ders {
+			crl, err := x509.ParseRevocationList(der)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse CRL file %s: %v", file, err)
+			}
+
+			verified := false
+			for _, ca := range caCerts {
+				if bytes.Equal(ca.RawSubject, crl.RawIssuer) && crl.CheckSignatureFrom(ca) == nil {
+					verified = true
+					break
+				}
+			}
+			if !verified {
+				return nil, fmt.Errorf("CRL file %s is not signed by a configured CA", file)
+			}
+
+			if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+				slog.Warn("CRL file is outdated", "file", file, "next_update", crl.NextUpdate)
+			}
+
+			for _, entry := range crl.RevokedCertificateEntries {
+				revoked[revocationKey(crl.RawIssuer, entry.SerialNumber.String())] = entry.RevocationTime
+			}
+		}
+	}
+
+	return revoked, nil
+}
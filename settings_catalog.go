@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SettingType describes the kind of value a cluster setting accepts
+type SettingType string
+
+const (
+	SettingTypeInt        SettingType = "int"
+	SettingTypeFloat      SettingType = "float"
+	SettingTypeBool       SettingType = "bool"
+	SettingTypeByteSize   SettingType = "bytesize"
+	SettingTypeTime       SettingType = "time"
+	SettingTypePercentage SettingType = "percentage"
+	SettingTypeWatermark  SettingType = "watermark"
+	SettingTypeEnum       SettingType = "enum"
+	SettingTypeString     SettingType = "string"
+)
+
+// SettingDefinition describes a known cluster setting
+type SettingDefinition struct {
+	Key         string      `json:"key"`
+	Type        SettingType `json:"type"`
+	Min         *float64    `json:"min,omitempty"`
+	Max         *float64    `json:"max,omitempty"`
+	Values      []string    `json:"values,omitempty"`
+	Hint        string      `json:"hint"`
+	Description string      `json:"description"`
+	DocsURL     string      `json:"docs_url"`
+}
+
+// SettingValidationError describes why a value was rejected for a setting
+type SettingValidationError struct {
+	Scope    string `json:"scope"`
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Expected string `json:"expected"`
+	Message  string `json:"message"`
+}
+
+const (
+	docsAllocation = "https://www.elastic.co/guide/en/elasticsearch/reference/current/modules-cluster.html#cluster-shard-allocation-settings"
+	docsRebalance  = "https://www.elastic.co/guide/en/elasticsearch/reference/current/modules-cluster.html#shards-rebalancing-settings"
+	docsBalancing  = "https://www.elastic.co/guide/en/elasticsearch/reference/current/modules-cluster.html#shards-rebalancing-heuristics"
+	docsDisk       = "https://www.elastic.co/guide/en/elasticsearch/reference/current/modules-cluster.html#disk-based-shard-allocation"
+	docsFiltering  = "https://www.elastic.co/guide/en/elasticsearch/reference/current/modules-cluster.html#cluster-shard-allocation-filtering"
+	docsRecovery   = "https://www.elastic.co/guide/en/elasticsearch/reference/current/recovery.html"
+	docsMisc       = "https://www.elastic.co/guide/en/elasticsearch/reference/current/misc-cluster-settings.html"
+	docsIndexMgmt  = "https://www.elastic.co/guide/en/elasticsearch/reference/current/index-management-settings.html"
+	docsSearch     = "https://www.elastic.co/guide/en/elasticsearch/reference/current/search-settings.html"
+)
+
+var (
+	byteSizePattern = regexp.MustCompile(`(?i)^\d+(\.\d+)?\s*(b|kb|mb|gb|tb|pb)$`)
+	timePattern     = regexp.MustCompile(`^\d+(nanos|micros|ms|s|m|h|d)$`)
+	percentPattern  = regexp.MustCompile(`^(\d+(\.\d+)?)%$`)
+)
+
+// bound returns a pointer to v for use as a setting range limit
+func bound(v float64) *float64 {
+	return &v
+}
+
+// settingsCatalog lists the cluster settings the board knows how to validate
+var settingsCatalog = []SettingDefinition{
+	{Key: "cluster.routing.allocation.enable", Type: SettingTypeEnum, Values: []string{"all", "primaries", "new_primaries", "none"},
+		Description: "Enable/disable shard allocation for specific kinds of shards", DocsURL: docsAllocation},
+	{Key: "cluster.routing.allocation.node_concurrent_recoveries", Type: SettingTypeInt, Min: bound(0),
+		Description: "Number of concurrent shard recoveries allowed per node", DocsURL: docsAllocation},
+	{Key: "cluster.routing.allocation.node_concurrent_incoming_recoveries", Type: SettingTypeInt, Min: bound(0),
+		Description: "Number of concurrent incoming shard recoveries allowed per node", DocsURL: docsAllocation},
+	{Key: "cluster.routing.allocation.node_concurrent_outgoing_recoveries", Type: SettingTypeInt, Min: bound(0),
+		Description: "Number of concurrent outgoing shard recoveries allowed per node", DocsURL: docsAllocation},
+	{Key: "cluster.routing.allocation.node_initial_primaries_recoveries", Type: SettingTypeInt, Min: bound(0),
+		Description: "Number of initial primary shard recoveries per node", DocsURL: docsAllocation},
+	{Key: "cluster.routing.allocation.same_shard.host", Type: SettingTypeBool,
+		Description: "Prevent allocation of replica shards on the same host as primary", DocsURL: docsAllocation},
+	{Key: "cluster.routing.rebalance.enable", Type: SettingTypeEnum, Values: []string{"all", "primaries", "replicas", "none"},
+		Description: "Enable/disable shard rebalancing for specific kinds of shards", DocsURL: docsRebalance},
+	{Key: "cluster.routing.allocation.allow_rebalance", Type: SettingTypeEnum, Values: []string{"always", "indices_primaries_active", "indices_all_active"},
+		Description: "When shard rebalancing is allowed", DocsURL: docsRebalance},
+	{Key: "cluster.routing.allocation.cluster_concurrent_rebalance", Type: SettingTypeInt, Min: bound(-1),
+		Description: "Number of shards that can be moved simultaneously across the cluster (-1 for unlimited)", DocsURL: docsRebalance},
+	{Key: "cluster.routing.allocation.balance.shard", Type: SettingTypeFloat, Min: bound(0),
+		Description: "Weight factor for the total number of shards allocated per node", DocsURL: docsBalancing},
+	{Key: "cluster.routing.allocation.balance.index", Type: SettingTypeFloat, Min: bound(0),
+		Description: "Weight factor for the number of shards per index allocated on a node", DocsURL: docsBalancing},
+	{Key: "cluster.routing.allocation.balance.threshold", Type: SettingTypeFloat, Min: bound(0),
+		Description: "Minimal optimization value of operations that should be performed", DocsURL: docsBalancing},
+	{Key: "cluster.routing.allocation.total_shards_per_node", Type: SettingTypeInt, Min: bound(-1),
+		Description: "Maximum number of primary and replica shards allocated to each node (-1 for unlimited)", DocsURL: docsAllocation},
+	{Key: "cluster.routing.allocation.disk.threshold_enabled", Type: SettingTypeBool,
+		Description: "Enable disk-based shard allocation decisions", DocsURL: docsDisk},
+	{Key: "cluster.routing.allocation.disk.watermark.low", Type: SettingTypeWatermark,
+		Description: "Low disk watermark threshold", DocsURL: docsDisk},
+	{Key: "cluster.routing.allocation.disk.watermark.high", Type: SettingTypeWatermark,
+		Description: "High disk watermark threshold", DocsURL: docsDisk},
+	{Key: "cluster.routing.allocation.disk.watermark.flood_stage", Type: SettingTypeWatermark,
+		Description: "Flood stage disk watermark threshold", DocsURL: docsDisk},
+	{Key: "cluster.info.update.interval", Type: SettingTypeTime,
+		Description: "How often disk usage is checked for disk-based allocation", DocsURL: docsDisk},
+	{Key: "cluster.routing.allocation.exclude._name", Type: SettingTypeString,
+		Description: "Comma-separated node names to move all shards away from", DocsURL: docsFiltering},
+	{Key: "cluster.routing.allocation.exclude._ip", Type: SettingTypeString,
+		Description: "Comma-separated node IP addresses to move all shards away from", DocsURL: docsFiltering},
+	{Key: "cluster.routing.allocation.exclude._host", Type: SettingTypeString,
+		Description: "Comma-separated node host names to move all shards away from", DocsURL: docsFiltering},
+	{Key: "cluster.routing.allocation.awareness.attributes", Type: SettingTypeString,
+		Description: "Node attributes used for shard allocation awareness", DocsURL: docsAllocation},
+	{Key: "cluster.max_shards_per_node", Type: SettingTypeInt, Min: bound(1),
+		Description: "Maximum number of shards per node", DocsURL: docsMisc},
+	{Key: "cluster.blocks.read_only", Type: SettingTypeBool,
+		Description: "Make the whole cluster read only", DocsURL: docsMisc},
+	{Key: "cluster.blocks.read_only_allow_delete", Type: SettingTypeBool,
+		Description: "Make the whole cluster read only, but allow deleting indices", DocsURL: docsMisc},
+	{Key: "indices.recovery.max_bytes_per_sec", Type: SettingTypeByteSize,
+		Description: "Maximum bytes per second for shard recovery per node", DocsURL: docsRecovery},
+	{Key: "indices.recovery.max_concurrent_file_chunks", Type: SettingTypeInt, Min: bound(1), Max: bound(8),
+		Description: "Number of file chunks sent in parallel for each recovery", DocsURL: docsRecovery},
+	{Key: "indices.recovery.max_concurrent_operations", Type: SettingTypeInt, Min: bound(1), Max: bound(4),
+		Description: "Number of operations sent in parallel for each recovery", DocsURL: docsRecovery},
+	{Key: "indices.recovery.concurrent_streams", Type: SettingTypeInt, Min: bound(1),
+		Description: "Number of concurrent streams for shard recovery", DocsURL: docsRecovery},
+	{Key: "action.destructive_requires_name", Type: SettingTypeBool,
+		Description: "Require explicit index names when deleting indices", DocsURL: docsIndexMgmt},
+	{Key: "search.default_search_timeout", Type: SettingTypeTime,
+		Description: "Default timeout for search requests (-1 for no timeout)", DocsURL: docsSearch},
+}
+
+func init() {
+	for i := range settingsCatalog {
+		settingsCatalog[i].Hint = settingsCatalog[i].expected()
+	}
+}
+
+// lookupSetting returns the catalog entry for a setting key
+func lookupSetting(key string) (SettingDefinition, bool) {
+	i := slices.IndexFunc(settingsCatalog, func(def SettingDefinition) bool { return def.Key == key })
+	if i < 0 {
+		return SettingDefinition{}, false
+	}
+	return settingsCatalog[i], true
+}
+
+// expected returns a short human readable description of the accepted values
+func (def SettingDefinition) expected() string {
+	var hint string
+	switch def.Type {
+	case SettingTypeInt:
+		hint = "integer"
+	case SettingTypeFloat:
+		hint = "number"
+	case SettingTypeBool:
+		hint = "true or false"
+	case SettingTypeByteSize:
+		hint = "byte size, e.g. 40mb"
+	case SettingTypeTime:
+		hint = "time value, e.g. 30s"
+	case SettingTypePercentage:
+		hint = "percentage or ratio, e.g. 85% or 0.85"
+	case SettingTypeWatermark:
+		hint = "percentage, ratio or byte size, e.g. 85%, 0.85 or 500gb"
+	case SettingTypeEnum:
+		hint = "one of " + strings.Join(def.Values, ", ")
+	default:
+		hint = "string"
+	}
+
+	switch {
+	case def.Min != nil && def.Max != nil:
+		hint += fmt.Sprintf(" between %s and %s", formatBound(*def.Min), formatBound(*def.Max))
+	case def.Min != nil:
+		hint += fmt.Sprintf(" >= %s", formatBound(*def.Min))
+	case def.Max != nil:
+		hint += fmt.Sprintf(" <= %s", formatBound(*def.Max))
+	}
+	return hint
+}
+
+// formatBound formats a range limit without trailing zeros
+func formatBound(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Validate checks a new value against the setting definition. A null value
+// resets the setting and is always accepted.
+func (def SettingDefinition) Validate(value any) error {
+	if value == nil {
+		return nil
+	}
+
+	switch def.Type {
+	case SettingTypeInt, SettingTypeFloat:
+		n, ok := settingNumber(value)
+		if !ok {
+			return fmt.Errorf("not a number")
+		}
+		if def.Type == SettingTypeInt && n != math.Trunc(n) {
+			return fmt.Errorf("not an integer")
+		}
+		if def.Min != nil && n < *def.Min {
+			return fmt.Errorf("must be >= %s", formatBound(*def.Min))
+		}
+		if def.Max != nil && n > *def.Max {
+			return fmt.Errorf("must be <= %s", formatBound(*def.Max))
+		}
+	case SettingTypeBool:
+		switch v := value.(type) {
+		case bool:
+		case string:
+			if v != "true" && v != "false" {
+				return fmt.Errorf("not a boolean")
+			}
+		default:
+			return fmt.Errorf("not a boolean")
+		}
+	case SettingTypeByteSize:
+		if !isByteSize(value) {
+			return fmt.Errorf("not a byte size with unit")
+		}
+	case SettingTypeTime:
+		if !isTimeValue(value) {
+			return fmt.Errorf("not a time value with unit")
+		}
+	case SettingTypePercentage:
+		if !isPercentage(value) {
+			return fmt.Errorf("not a percentage or ratio")
+		}
+	case SettingTypeWatermark:
+		if !isPercentage(value) && !isByteSize(value) {
+			return fmt.Errorf("not a percentage, ratio or byte size")
+		}
+	case SettingTypeEnum:
+		v, ok := value.(string)
+		if !ok || !slices.Contains(def.Values, v) {
+			return fmt.Errorf("not an allowed value")
+		}
+	case SettingTypeString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("not a string")
+		}
+	}
+	return nil
+}
+
+// settingNumber converts a JSON number or numeric string to float64
+func settingNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// isByteSize checks for a byte size like 40mb, or the unitless 0 and -1
+func isByteSize(value any) bool {
+	switch v := value.(type) {
+	case float64:
+		return v == 0 || v == -1
+	case string:
+		return v == "0" || v == "-1" || byteSizePattern.MatchString(strings.TrimSpace(v))
+	}
+	return false
+}
+
+// isTimeValue checks for a time value like 30s, or the unitless 0 and -1
+func isTimeValue(value any) bool {
+	switch v := value.(type) {
+	case float64:
+		return v == 0 || v == -1
+	case string:
+		return v == "0" || v == "-1" || timePattern.MatchString(strings.TrimSpace(v))
+	}
+	return false
+}
+
+// isPercentage checks for a percentage between 0% and 100% or a ratio between 0 and 1
+func isPercentage(value any) bool {
+	if s, ok := value.(string); ok {
+		if m := percentPattern.FindStringSubmatch(strings.TrimSpace(s)); m != nil {
+			p, _ := strconv.ParseFloat(m[1], 64)
+			return p <= 100
+		}
+	}
+	n, ok := settingNumber(value)
+	return ok && n >= 0 && n <= 1
+}
+
+// validateSettingsChanges checks every change against the catalog. Unknown
+// settings are passed through to Elasticsearch unvalidated.
+func validateSettingsChanges(changes []SettingsChange) []SettingValidationError {
+	var errs []SettingValidationError
+	for _, change := range changes {
+		def, ok := lookupSetting(change.Key)
+		if !ok {
+			continue
+		}
+		if err := def.Validate(change.After); err != nil {
+			errs = append(errs, SettingValidationError{
+				Scope:    change.Scope,
+				Key:      change.Key,
+				Value:    change.After,
+				Expected: def.Hint,
+				Message:  fmt.Sprintf("invalid value %v for %s: %v (expected %s)", change.After, change.Key, err, def.Hint),
+			})
+		}
+	}
+	return errs
+}
+
+// writeSettingsValidationErrors responds with a structured JSON validation error
+func writeSettingsValidationErrors(w http.ResponseWriter, errs []SettingValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":  "invalid_setting_value",
+		"errors": errs,
+	})
+}
+
+// settingsCatalogHandler returns the known cluster settings as JSON
+func settingsCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settingsCatalog)
+}
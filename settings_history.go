@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SettingsChange is a single cluster setting change made through the board
+type SettingsChange struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Scope  string    `json:"scope"`
+	Key    string    `json:"key"`
+	Before any       `json:"before"`
+	After  any       `json:"after"`
+}
+
+// SettingsHistory keeps a persistent, append-only log of cluster setting
+// changes. The file is rewritten with the newest maxEntries changes when it
+// grows beyond them.
+type SettingsHistory struct {
+	file       string
+	maxEntries int
+	entries    []SettingsChange
+	// fileEntries is the number of lines in the history file
+	fileEntries int
+	nextID      int64
+	mutex       sync.RWMutex
+}
+
+var settingsHistory *SettingsHistory
+
+// NewSettingsHistory creates a settings history backed by a JSON lines file.
+// An empty file name keeps the history in memory only.
+func NewSettingsHistory(file string, maxEntries int) (*SettingsHistory, error) {
+	h := &SettingsHistory{
+		file:       file,
+		maxEntries: maxEntries,
+		nextID:     1,
+	}
+
+	if err := h.load(); err != nil {
+		return nil, fmt.Errorf("failed to load settings history: %v", err)
+	}
+
+	return h, nil
+}
+
+// load reads previously recorded changes from the history file
+func (h *SettingsHistory) load() error {
+	if h.file == "" {
+		return nil
+	}
+
+	f, err := os.Open(h.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		h.fileEntries++
+
+		var change SettingsChange
+		if err := json.Unmarshal([]byte(line), &change); err != nil {
+			slog.Warn("Skipping invalid settings history entry", "file", h.file, "error", err)
+			continue
+		}
+		h.entries = append(h.entries, change)
+		if change.ID >= h.nextID {
+			h.nextID = change.ID + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	h.trim()
+	if h.maxEntries > 0 && h.fileEntries > h.maxEntries {
+		if err := h.compact(); err != nil {
+			slog.Warn("Failed to compact settings history file", "file", h.file, "error", err)
+		}
+	}
+	return nil
+}
+
+// trim drops the oldest in-memory entries beyond maxEntries
+func (h *SettingsHistory) trim() {
+	if h.maxEntries > 0 && len(h.entries) > h.maxEntries {
+		h.entries = slices.Clone(h.entries[len(h.entries)-h.maxEntries:])
+	}
+}
+
+// Record stores the given changes and appends them to the history file
+func (h *SettingsHistory) Record(changes []SettingsChange) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for i := range changes {
+		changes[i].ID = h.nextID
+		changes[i].Time = now
+		h.nextID++
+	}
+	h.entries = append(h.entries, changes...)
+	h.trim()
+
+	if h.file == "" {
+		return nil
+	}
+
+	// Rewrite instead of appending once the file would exceed maxEntries,
+	// appending keeps the changes if that fails
+	if h.maxEntries > 0 && h.fileEntries+len(changes) > h.maxEntries {
+		err := h.compact()
+		if err == nil {
+			return nil
+		}
+		slog.Warn("Failed to compact settings history file", "file", h.file, "error", err)
+	}
+
+	f, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open settings history file %s: %v", h.file, err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, change := range changes {
+		if err := encoder.Encode(change); err != nil {
+			return fmt.Errorf("failed to write settings history file %s: %v", h.file, err)
+		}
+		h.fileEntries++
+	}
+	return nil
+}
+
+// compact replaces the history file with the in-memory entries. The new file
+// is renamed over the old one, so a crash leaves one of them intact. The
+// caller must hold the mutex or own h exclusively.
+func (h *SettingsHistory) compact() error {
+	f, err := os.CreateTemp(filepath.Dir(h.file), filepath.Base(h.file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create settings history file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, change := range h.entries {
+		if err := encoder.Encode(change); err != nil {
+			return fmt.Errorf("failed to write settings history file %s: %v", f.Name(), err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write settings history file %s: %v", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write settings history file %s: %v", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), h.file); err != nil {
+		return fmt.Errorf("failed to replace settings history file %s: %v", h.file, err)
+	}
+
+	slog.Debug("Compacted settings history file", "file", h.file, "entries", len(h.entries))
+	h.fileEntries = len(h.entries)
+	return nil
+}
+
+// Entries returns all recorded changes, newest first
+func (h *SettingsHistory) Entries() []SettingsChange {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	entries := slices.Clone(h.entries)
+	slices.Reverse(entries)
+	return entries
+}
+
+// isClusterSettingsUpdate checks if a proxied request modifies cluster
+// settings. path must be decoded, as returned by upstreamURL.
+func isClusterSettingsUpdate(method, esPath string) bool {
+	esPath, _, _ = strings.Cut(esPath, "?")
+	return method == http.MethodPut && path.Clean("/"+esPath) == "/_cluster/settings"
+}
+
+// parseSettingsUpdate turns a cluster settings request body into one change per
+// setting key. Nested objects are flattened into dotted keys.
+func parseSettingsUpdate(body string) ([]SettingsChange, error) {
+	var update map[string]any
+	if err := json.Unmarshal([]byte(body), &update); err != nil {
+		return nil, fmt.Errorf("invalid cluster settings body: %v", err)
+	}
+
+	var changes []SettingsChange
+	for _, scope := range []string{"persistent", "transient"} {
+		settings, ok := update[scope].(map[string]any)
+		if !ok {
+			continue
+		}
+		flat := make(map[string]any)
+		flattenSettings("", settings, flat)
+		for key, value := range flat {
+			changes = append(changes, SettingsChange{Scope: scope, Key: key, After: value})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b SettingsChange) int {
+		return strings.Compare(a.Scope+a.Key, b.Scope+b.Key)
+	})
+	return changes, nil
+}
+
+// flattenSettings converts nested setting objects into dotted keys
+func flattenSettings(prefix string, settings map[string]any, flat map[string]any) {
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			flattenSettings(key, nested, flat)
+			continue
+		}
+		flat[key] = value
+	}
+}
+
+// fillSettingsBefore sets the Before value of each change from the current cluster settings
+func fillSettingsBefore(changes []SettingsChange, current *ClusterSettings) {
+	for i := range changes {
+		scopeSettings := current.Persistent
+		if changes[i].Scope == "transient" {
+			scopeSettings = current.Transient
+		}
+		changes[i].Before = scopeSettings[changes[i].Key]
+	}
+}
+
+// settingsHistoryHandler returns the recorded cluster setting changes as JSON
+func settingsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries := []SettingsChange{}
+	if settingsHistory != nil {
+		entries = settingsHistory.Entries()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
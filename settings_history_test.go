@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIsClusterSettingsUpdate(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodPut, "/_cluster/settings", true},
+		{http.MethodPut, "/_cluster/settings/", true},
+		{http.MethodPut, "/_cluster/settings?flat_settings=true", true},
+		{http.MethodPut, "/_cluster/%73ettings", true},
+		{http.MethodPut, "/%5Fcluster/settings", true},
+		{http.MethodPut, "/%5f%63luster/%73ettings?timeout=30s", true},
+		{http.MethodPut, "/_cluster//settings", true},
+		{http.MethodPut, "/_cluster/settings%2F", true},
+		{http.MethodGet, "/_cluster/settings", false},
+		{http.MethodGet, "/_cluster/%73ettings", false},
+		{http.MethodPut, "/_cluster/settingsx", false},
+		{http.MethodPut, "/_cluster/health", false},
+		{http.MethodPut, "/my-index/_settings", false},
+	}
+
+	for _, tt := range tests {
+		_, esPath, err := upstreamURL(tt.path)
+		if err != nil {
+			t.Fatalf("upstreamURL(%q) failed: %v", tt.path, err)
+		}
+		if got := isClusterSettingsUpdate(tt.method, esPath); got != tt.want {
+			t.Errorf("isClusterSettingsUpdate(%s, %q) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// historyFileIDs returns the IDs of the changes in a history file
+func historyFileIDs(t *testing.T, file string) []int64 {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var ids []int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var change SettingsChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, change.ID)
+	}
+	return ids
+}
+
+func TestSettingsHistoryCompaction(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := NewSettingsHistory(file, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 5 {
+		if err := h.Record([]SettingsChange{{Scope: "persistent", Key: "cluster.routing.allocation.enable", After: i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := historyFileIDs(t, file); !slices.Equal(ids, []int64{3, 4, 5}) {
+		t.Errorf("history file has IDs %v, want [3 4 5]", ids)
+	}
+	if err := h.Record([]SettingsChange{{Scope: "persistent", Key: "a"}, {Scope: "transient", Key: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := historyFileIDs(t, file); !slices.Equal(ids, []int64{5, 6, 7}) {
+		t.Errorf("history file has IDs %v, want [5 6 7]", ids)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("history file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+	if matches, _ := filepath.Glob(file + ".*"); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+	// A lower max_entries compacts the file on startup and keeps the IDs unique
+	h, err = NewSettingsHistory(file, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := historyFileIDs(t, file); !slices.Equal(ids, []int64{6, 7}) {
+		t.Errorf("history file has IDs %v after loading, want [6 7]", ids)
+	}
+	if err := h.Record([]SettingsChange{{Scope: "persistent", Key: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := historyFileIDs(t, file); !slices.Equal(ids, []int64{7, 8}) {
+		t.Errorf("history file has IDs %v, want [7 8]", ids)
+	}
+}
+
+func TestSettingsHistoryUnlimited(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := NewSettingsHistory(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		if err := h.Record([]SettingsChange{{Scope: "persistent", Key: "a"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := historyFileIDs(t, file); len(ids) != 10 {
+		t.Errorf("history file has %d entries, want 10", len(ids))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SettingPreview shows how a single setting would change
+type SettingPreview struct {
+	Scope                string `json:"scope"`
+	Key                  string `json:"key"`
+	Current              any    `json:"current"`
+	Proposed             any    `json:"proposed"`
+	Default              any    `json:"default"`
+	EffectiveBefore      any    `json:"effective_before"`
+	EffectiveLayerBefore string `json:"effective_layer_before"`
+	EffectiveAfter       any    `json:"effective_after"`
+	EffectiveLayerAfter  string `json:"effective_layer_after"`
+}
+
+// SettingWarning describes an interaction between settings the operator should know about
+type SettingWarning struct {
+	Keys    []string `json:"keys"`
+	Message string   `json:"message"`
+}
+
+// SettingsPreview is the dry-run result for a cluster settings change
+type SettingsPreview struct {
+	Valid    bool                     `json:"valid"`
+	Changes  []SettingPreview         `json:"changes"`
+	Errors   []SettingValidationError `json:"errors"`
+	Warnings []SettingWarning         `json:"warnings"`
+}
+
+var allocationExcludeKeys = []string{
+	"cluster.routing.allocation.exclude._name",
+	"cluster.routing.allocation.exclude._ip",
+	"cluster.routing.allocation.exclude._host",
+}
+
+var diskWatermarkKeys = []string{
+	"cluster.routing.allocation.disk.watermark.low",
+	"cluster.routing.allocation.disk.watermark.high",
+	"cluster.routing.allocation.disk.watermark.flood_stage",
+}
+
+// previewSettingsChanges computes the diff and interaction warnings of applying
+// the changes to the current settings, without sending anything to Elasticsearch
+func previewSettingsChanges(changes []SettingsChange, current *ClusterSettings) SettingsPreview {
+	after := current.Apply(changes)
+
+	preview := SettingsPreview{
+		Changes:  []SettingPreview{},
+		Errors:   validateSettingsChanges(changes),
+		Warnings: settingsInteractions(changes, after),
+	}
+	if preview.Errors == nil {
+		preview.Errors = []SettingValidationError{}
+	}
+	if preview.Warnings == nil {
+		preview.Warnings = []SettingWarning{}
+	}
+	preview.Valid = len(preview.Errors) == 0
+
+	for _, change := range changes {
+		layer := current.Persistent
+		if change.Scope == "transient" {
+			layer = current.Transient
+		}
+		p := SettingPreview{
+			Scope:    change.Scope,
+			Key:      change.Key,
+			Current:  layer[change.Key],
+			Proposed: change.After,
+			Default:  current.Defaults[change.Key],
+		}
+		p.EffectiveBefore, p.EffectiveLayerBefore = current.Effective(change.Key)
+		p.EffectiveAfter, p.EffectiveLayerAfter = after.Effective(change.Key)
+		preview.Changes = append(preview.Changes, p)
+	}
+
+	return preview
+}
+
+// settingsInteractions returns warnings about how the changed settings interact
+// with other settings in the resulting cluster state
+func settingsInteractions(changes []SettingsChange, after *ClusterSettings) []SettingWarning {
+	var warnings []SettingWarning
+
+	changed := func(keys ...string) bool {
+		return slices.ContainsFunc(changes, func(c SettingsChange) bool { return slices.Contains(keys, c.Key) })
+	}
+	effective := func(key string) string {
+		v, _ := after.Effective(key)
+		return settingString(v)
+	}
+
+	// A persistent value has no effect while a transient value for the same key exists
+	for _, change := range changes {
+		if change.Scope != "persistent" || change.After == nil {
+			continue
+		}
+		if v, ok := after.Transient[change.Key]; ok {
+			warnings = append(warnings, SettingWarning{
+				Keys:    []string{change.Key},
+				Message: fmt.Sprintf("the transient value %v overrides the new persistent value of %s", v, change.Key),
+			})
+		}
+	}
+
+	// Restricted allocation keeps shards on excluded nodes from moving away
+	var excluded []string
+	for _, key := range allocationExcludeKeys {
+		if v := effective(key); v != "" {
+			excluded = append(excluded, key+"="+v)
+		}
+	}
+	allocationEnable := effective("cluster.routing.allocation.enable")
+	if len(excluded) > 0 && allocationEnable != "" && allocationEnable != "all" &&
+		changed(append([]string{"cluster.routing.allocation.enable"}, allocationExcludeKeys...)...) {
+		warnings = append(warnings, SettingWarning{
+			Keys:    append([]string{"cluster.routing.allocation.enable"}, allocationExcludeKeys...),
+			Message: fmt.Sprintf("allocation is restricted to %q while nodes are excluded (%s), so shards may not move off the excluded nodes", allocationEnable, strings.Join(excluded, ", ")),
+		})
+	}
+	if allocationEnable == "none" && changed("cluster.routing.allocation.enable") {
+		warnings = append(warnings, SettingWarning{
+			Keys:    []string{"cluster.routing.allocation.enable"},
+			Message: "no shards will be allocated, including replicas of new indices and shards of restarted nodes",
+		})
+	}
+
+	// Rebalance tuning has no effect while rebalancing is disabled
+	if effective("cluster.routing.rebalance.enable") == "none" &&
+		changed("cluster.routing.allocation.cluster_concurrent_rebalance", "cluster.routing.allocation.allow_rebalance") {
+		warnings = append(warnings, SettingWarning{
+			Keys:    []string{"cluster.routing.rebalance.enable", "cluster.routing.allocation.cluster_concurrent_rebalance", "cluster.routing.allocation.allow_rebalance"},
+			Message: "rebalancing is disabled (cluster.routing.rebalance.enable=none), so rebalance settings have no effect",
+		})
+	}
+
+	// Disk watermarks are ignored without the disk threshold decider and must be ordered
+	if changed(diskWatermarkKeys...) {
+		if effective("cluster.routing.allocation.disk.threshold_enabled") == "false" {
+			warnings = append(warnings, SettingWarning{
+				Keys:    append([]string{"cluster.routing.allocation.disk.threshold_enabled"}, diskWatermarkKeys...),
+				Message: "disk-based allocation is disabled (cluster.routing.allocation.disk.threshold_enabled=false), so watermarks have no effect",
+			})
+		}
+
+		var ratios []float64
+		for _, key := range diskWatermarkKeys {
+			if r, ok := watermarkRatio(effective(key)); ok {
+				ratios = append(ratios, r)
+			}
+		}
+		if len(ratios) == len(diskWatermarkKeys) && !slices.IsSorted(ratios) {
+			warnings = append(warnings, SettingWarning{
+				Keys:    diskWatermarkKeys,
+				Message: "disk watermarks must satisfy low <= high <= flood_stage, Elasticsearch will reject this change",
+			})
+		}
+	}
+
+	// Cluster-wide blocks stop all writes
+	for _, key := range []string{"cluster.blocks.read_only", "cluster.blocks.read_only_allow_delete"} {
+		if changed(key) && effective(key) == "true" {
+			warnings = append(warnings, SettingWarning{
+				Keys:    []string{key},
+				Message: fmt.Sprintf("%s=true blocks all writes to the cluster", key),
+			})
+		}
+	}
+
+	return warnings
+}
+
+// settingString formats a setting value the way Elasticsearch returns flat settings
+func settingString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = settingString(item)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// watermarkRatio converts a percentage or ratio watermark to a ratio of used disk
+func watermarkRatio(value string) (float64, bool) {
+	if m := percentPattern.FindStringSubmatch(value); m != nil {
+		p, err := strconv.ParseFloat(m[1], 64)
+		return p / 100, err == nil
+	}
+	r, err := strconv.ParseFloat(value, 64)
+	return r, err == nil && r <= 1
+}
+
+// settingsPreviewHandler returns the dry-run preview of a cluster settings
+// change. The request body has the same format as PUT /_cluster/settings.
+func settingsPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	proxyConfig := configManager.Get().Proxy
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, proxyConfig.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := parseSettingsUpdate(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timeout := proxyConfig.TimeoutFor("/_cluster/settings")
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	current, err := fetchClusterSettings(ctx, true)
+	if err != nil {
+		writeUpstreamError(w, r, err, timeout)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(previewSettingsChanges(changes, current))
+}